@@ -4,8 +4,11 @@ import (
 	"context"
 	"log"
 
+	"auth-server/internal/breach"
 	"auth-server/internal/config"
 	"auth-server/internal/handlers"
+	"auth-server/internal/keys"
+	"auth-server/internal/mail"
 	"auth-server/internal/middleware"
 	"auth-server/internal/repository"
 	"auth-server/internal/routes"
@@ -24,6 +27,7 @@ func main() {
 	if err := config.ConnectDatabase(); err != nil {
 		log.Fatalf("failed to connect database: %v", err)
 	}
+	seed.SeedRoles(config.Database)
 	seed.SeedUsers(config.Database)
 
 	rdb := redis.NewClient(&redis.Options{
@@ -36,17 +40,71 @@ func main() {
 		log.Fatalf("failed to connect redis: %v", err)
 	}
 
-	middleware.InitMiddleware(rdb)
+	keySet, err := keys.Load(config.AppConfig.JWT)
+	if err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+
+	mailer, err := mail.New(config.AppConfig.Mail)
+	if err != nil {
+		log.Fatalf("failed to set up mailer: %v", err)
+	}
 
 	userRepo := repository.NewUserRepositoryGorm(config.Database)
-	authService := services.NewAuthService(userRepo, rdb)
-	userService := services.NewUserService(userRepo)
+	clientRepo := repository.NewOAuthClientRepositoryGorm(config.Database)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepositoryGorm(config.Database)
+	roleRepo := repository.NewRoleRepositoryGorm(config.Database)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepositoryGorm(config.Database)
+	apiKeyRepo := repository.NewAPIKeyRepositoryGorm(config.Database)
+	serviceClientRepo := repository.NewServiceClientRepositoryGorm(config.Database)
+	identityRepo := repository.NewIdentityRepositoryGorm(config.Database)
+	passkeyRepo := repository.NewWebAuthnCredentialRepositoryGorm(config.Database)
+	auditRepo := repository.NewAuditEventRepositoryGorm(config.Database)
+	loginLimiter := services.NewLoginLimiter(userRepo, rdb)
+	twoFactorService := services.NewTwoFactorService(userRepo, recoveryCodeRepo, loginLimiter, rdb)
+	sessionService := services.NewSessionService(rdb)
+	tokenVersions := services.NewTokenVersionStore(userRepo, rdb)
+	tokenDenylist := services.NewTokenDenylist(rdb)
+	roleService := services.NewRoleService(roleRepo, tokenVersions)
+	auditService := services.NewAuditService(auditRepo, userRepo)
+	passwordPolicy := services.NewPasswordPolicy(passwordHistoryRepo, breach.Bundled())
+	authenticators := []services.Authenticator{
+		services.NewLocalAuthenticator(userRepo),
+		services.NewLDAPAuthenticator(identityRepo, userRepo, roleService, tokenVersions),
+	}
+	authService := services.NewAuthService(userRepo, sessionService, tokenVersions, roleService, twoFactorService, loginLimiter, tokenDenylist, passkeyRepo, auditService, authenticators, rdb, keySet)
+	userService := services.NewUserService(userRepo, loginLimiter, sessionService, tokenVersions, roleService, passwordPolicy, apiKeyRepo)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo, roleService)
+	serviceClientService := services.NewServiceClientService(serviceClientRepo, tokenDenylist, keySet)
+	passwordResetService := services.NewPasswordResetService(userRepo, identityRepo, userService, mailer, rdb)
+	magicLinkService := services.NewMagicLinkService(userRepo, authService, mailer, rdb)
+	oidcService := services.NewOIDCService(clientRepo, userRepo, authService)
+	introspectionService := services.NewIntrospectionService(authService, serviceClientService, tokenDenylist)
+	federationService := services.NewFederationService(identityRepo, userRepo, roleService, tokenVersions, authService, rdb)
+	webAuthnService := services.NewWebAuthnService(passkeyRepo, userRepo, authService, rdb)
+
+	middleware.InitMiddleware(authService, apiKeyService, serviceClientService, auditService, roleService)
 
 	authHandler := handlers.NewAuthHandler(authService)
 	userHandler := handlers.NewUserHandler(userService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService, serviceClientService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	roleHandler := handlers.NewRoleHandler(roleService)
+	passwordHandler := handlers.NewPasswordHandler(passwordResetService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	serviceClientHandler := handlers.NewServiceClientHandler(serviceClientService)
+	introspectionHandler := handlers.NewIntrospectionHandler(introspectionService, serviceClientService)
+	federationHandler := handlers.NewFederationHandler(federationService)
+	webAuthnHandler := handlers.NewWebAuthnHandler(webAuthnService)
+	magicLinkHandler := handlers.NewMagicLinkHandler(magicLinkService)
+	auditHandler := handlers.NewAuditHandler(auditService)
 
 	r := gin.Default()
-	routes.SetupRoutes(r, authHandler, userHandler)
+	if err := r.SetTrustedProxies(config.AppConfig.Server.TrustedProxies); err != nil {
+		log.Fatalf("invalid trusted proxies: %v", err)
+	}
+	routes.SetupRoutes(r, authHandler, userHandler, oidcHandler, twoFactorHandler, sessionHandler, roleHandler, passwordHandler, apiKeyHandler, serviceClientHandler, introspectionHandler, federationHandler, webAuthnHandler, magicLinkHandler, auditHandler)
 
 	log.Printf("Server starting on localhost:8080")
 	if err := r.Run(":8080"); err != nil {
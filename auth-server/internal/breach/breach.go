@@ -0,0 +1,70 @@
+// Package breach checks passwords against a list of known-breached password
+// hashes bundled with the binary.
+//
+// The list uses the k-anonymity layout of the Pwned Passwords range API: SHA-1
+// hashes split into a 5 character prefix and the remaining suffix. Lookups go
+// by prefix, so the list can later be swapped for the remote range API without
+// ever sending a full hash.
+package breach
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"strings"
+)
+
+//go:embed sha1_prefixes.txt
+var bundledList string
+
+// Checker reports whether a password is known to have been breached.
+type Checker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// List is an in-memory prefix → suffixes index.
+type List struct {
+	ranges map[string]map[string]struct{}
+}
+
+// Bundled returns the list embedded in the binary.
+func Bundled() *List {
+	return Parse(bundledList)
+}
+
+// Parse reads PREFIX:SUFFIX lines; blank lines and lines starting with # are
+// skipped.
+func Parse(data string) *List {
+	l := &List{ranges: map[string]map[string]struct{}{}}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prefix, suffix, ok := strings.Cut(line, ":")
+		if !ok || len(prefix) != 5 {
+			continue
+		}
+		prefix, suffix = strings.ToUpper(prefix), strings.ToUpper(suffix)
+		if l.ranges[prefix] == nil {
+			l.ranges[prefix] = map[string]struct{}{}
+		}
+		l.ranges[prefix][suffix] = struct{}{}
+	}
+	return l
+}
+
+func (l *List) IsBreached(ctx context.Context, password string) (bool, error) {
+	prefix, suffix := split(password)
+	_, found := l.ranges[prefix][suffix]
+	return found, nil
+}
+
+func split(password string) (prefix, suffix string) {
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return h[:5], h[5:]
+}
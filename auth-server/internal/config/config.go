@@ -10,10 +10,24 @@ import (
 )
 
 type Config struct {
-	DB     DBConfig
-	Redis  RedisConfig
-	JWT    JWTConfig
-	Server ServerConfig
+	DB                DBConfig
+	Redis             RedisConfig
+	JWT               JWTConfig
+	Server            ServerConfig
+	OIDC              OIDCConfig
+	TwoFactor         TwoFactorConfig       `mapstructure:"two_factor"`
+	LoginProtection   LoginProtectionConfig `mapstructure:"login_protection"`
+	Mail              MailConfig
+	PasswordReset     PasswordResetConfig     `mapstructure:"password_reset"`
+	MagicLink         MagicLinkConfig         `mapstructure:"magic_link"`
+	PasswordPolicy    PasswordPolicyConfig    `mapstructure:"password_policy"`
+	PasswordHashing   PasswordHashingConfig   `mapstructure:"password_hashing"`
+	ClientCredentials ClientCredentialsConfig `mapstructure:"client_credentials"`
+	Federation        FederationConfig
+	Authentication    AuthenticationConfig
+	LDAP              LDAPConfig
+	WebAuthn          WebAuthnConfig
+	Impersonation     ImpersonationConfig
 }
 
 type DBConfig struct {
@@ -32,12 +46,199 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	Expiration int
+	Expiration        int
+	RefreshExpiration int                `mapstructure:"refresh_expiration"`
+	ActiveKey         string             `mapstructure:"active_key"`
+	SigningKeys       []SigningKeyConfig `mapstructure:"signing_keys"`
+}
+
+type SigningKeyConfig struct {
+	ID             string `mapstructure:"kid"`
+	Algorithm      string
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+}
+
+type OIDCConfig struct {
+	Issuer string
+	// CodeExpiration is the lifetime of authorization codes, in seconds.
+	CodeExpiration int `mapstructure:"code_expiration"`
+	// DeviceCodeExpiration is the lifetime of device authorization requests
+	// and DevicePollInterval the initial polling interval, in seconds.
+	DeviceCodeExpiration int `mapstructure:"device_code_expiration"`
+	DevicePollInterval   int `mapstructure:"device_poll_interval"`
+}
+
+type ClientCredentialsConfig struct {
+	// TokenExpiration is the lifetime of service client tokens, in seconds.
+	TokenExpiration int `mapstructure:"token_expiration"`
+}
+
+type TwoFactorConfig struct {
+	// Issuer is the account label shown in authenticator apps.
+	Issuer string
+}
+
+// LoginProtectionConfig durations are in seconds.
+type LoginProtectionConfig struct {
+	MaxAttempts   int `mapstructure:"max_attempts"`
+	IPMaxAttempts int `mapstructure:"ip_max_attempts"`
+	Window        int
+	Lockout       int
+	MaxLockout    int `mapstructure:"max_lockout"`
+}
+
+// MailConfig selects how outgoing mail is delivered. Driver is "smtp" or
+// "file"; the file driver appends messages to File, or writes them to the log
+// when File is empty.
+type MailConfig struct {
+	Driver string
+	From   string
+	File   string
+	SMTP   SMTPConfig
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+type PasswordResetConfig struct {
+	// TokenExpiration is the lifetime of reset tokens, in seconds.
+	TokenExpiration int `mapstructure:"token_expiration"`
+	// URL is the page the emailed link points at; the token is appended as
+	// the "token" query parameter.
+	URL string
+}
+
+type MagicLinkConfig struct {
+	// TokenExpiration is the lifetime of login links, in seconds.
+	TokenExpiration int `mapstructure:"token_expiration"`
+	// URL is the page the emailed link points at; the token is appended as
+	// the "token" query parameter.
+	URL string
+	// Roles may log in by link; a user needs all of their roles listed. The
+	// default is just "user".
+	Roles []string
+}
+
+type PasswordPolicyConfig struct {
+	MinLength        int  `mapstructure:"min_length"`
+	RequireUpper     bool `mapstructure:"require_upper"`
+	RequireLower     bool `mapstructure:"require_lower"`
+	RequireDigit     bool `mapstructure:"require_digit"`
+	RequireSymbol    bool `mapstructure:"require_symbol"`
+	DisallowUsername bool `mapstructure:"disallow_username"`
+	// HistorySize is how many previous passwords cannot be reused; 0 disables
+	// the check.
+	HistorySize   int  `mapstructure:"history_size"`
+	CheckBreached bool `mapstructure:"check_breached"`
+}
+
+// PasswordHashingConfig selects the algorithm for new password hashes,
+// "argon2id" or "bcrypt". Hashes made with either are always accepted.
+type PasswordHashingConfig struct {
+	Algorithm  string
+	Argon2     Argon2Config
+	BcryptCost int `mapstructure:"bcrypt_cost"`
+}
+
+type Argon2Config struct {
+	// Memory is in KiB.
+	Memory      int
+	Iterations  int
+	Parallelism int
+	SaltLength  int `mapstructure:"salt_length"`
+	KeyLength   int `mapstructure:"key_length"`
+}
+
+// AuthenticationConfig lists the backends that check passwords at login,
+// "local" and "ldap", in the order they are tried.
+type AuthenticationConfig struct {
+	Backends []string
+}
+
+// LDAPConfig configures the LDAP / Active Directory backend. Users are found
+// by searching BaseDN with UserFilter, where %s is the escaped login name,
+// using the BindDN service account, and then authenticated by binding as the
+// entry found.
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool   `mapstructure:"start_tls"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	BindDN             string `mapstructure:"bind_dn"`
+	BindPassword       string `mapstructure:"bind_password"`
+	BaseDN             string `mapstructure:"base_dn"`
+	UserFilter         string `mapstructure:"user_filter"`
+	// Timeout applies to connecting and to each request, in seconds.
+	Timeout           int
+	UsernameAttribute string `mapstructure:"username_attribute"`
+	EmailAttribute    string `mapstructure:"email_attribute"`
+	GroupAttribute    string `mapstructure:"group_attribute"`
+	// IDAttribute holds a stable unique ID of the entry, such as entryUUID or
+	// objectGUID; the DN is used when it is empty.
+	IDAttribute string `mapstructure:"id_attribute"`
+	// GroupRoles are checked in order on every login; the first group the
+	// user is a member of sets their role, DefaultRole applies otherwise.
+	GroupRoles  []LDAPGroupRoleConfig `mapstructure:"group_roles"`
+	DefaultRole string                `mapstructure:"default_role"`
+}
+
+type LDAPGroupRoleConfig struct {
+	Group string // DN of the group
+	Role  string
+}
+
+// FederationConfig lists the external OIDC identity providers users can log
+// in with.
+type FederationConfig struct {
+	Providers []IdentityProviderConfig
+}
+
+type IdentityProviderConfig struct {
+	// Name identifies the provider in URLs and in the identities table.
+	Name         string
+	Issuer       string
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	RedirectURL  string   `mapstructure:"redirect_url"`
+	Scopes       []string // openid is always requested
+	// UsernameClaim names the claim used as the user name of new local
+	// users; the default is preferred_username.
+	UsernameClaim string `mapstructure:"username_claim"`
+	// RoleMappings are checked in order on every login; the first match sets
+	// the user's role, DefaultRole applies when none matches.
+	RoleMappings []RoleMappingConfig `mapstructure:"role_mappings"`
+	DefaultRole  string              `mapstructure:"default_role"`
+}
+
+// RoleMappingConfig matches when Claim equals Value or, for list claims such
+// as groups, contains it.
+type RoleMappingConfig struct {
+	Claim string
+	Value string
+	Role  string
+}
+
+// WebAuthnConfig describes the relying party passkeys are registered with.
+type WebAuthnConfig struct {
+	RPID          string   `mapstructure:"rp_id"`
+	RPDisplayName string   `mapstructure:"rp_display_name"`
+	RPOrigins     []string `mapstructure:"rp_origins"`
+}
+
+type ImpersonationConfig struct {
+	// TokenExpiration is the lifetime of impersonation sessions, in seconds.
+	TokenExpiration int `mapstructure:"token_expiration"`
 }
 
 type ServerConfig struct {
 	Port string
+	// TrustedProxies are the addresses or CIDRs of the reverse proxies whose
+	// X-Forwarded-For header is believed. With none, the client IP is always
+	// the peer address, so the header cannot be used to dodge per-IP limits.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 var AppConfig *Config
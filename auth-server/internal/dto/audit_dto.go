@@ -0,0 +1,29 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEventResponse struct {
+	ID        uint            `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	ActorID   *uint           `json:"actor_id,omitempty"`
+	ActorName string          `json:"actor_name,omitempty"`
+	TargetID  *uint           `json:"target_id,omitempty"`
+	Action    string          `json:"action"`
+	Result    string          `json:"result"`
+	IP        string          `json:"ip,omitempty"`
+	UserAgent string          `json:"user_agent,omitempty"`
+	Diff      json.RawMessage `json:"diff"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+type AuditVerifyResponse struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// FirstInvalidID is the first entry that does not match the chain.
+	FirstInvalidID *uint `json:"first_invalid_id,omitempty"`
+	// LastHash is the hash of the last valid entry.
+	LastHash string `json:"last_hash"`
+}
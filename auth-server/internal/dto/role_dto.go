@@ -0,0 +1,32 @@
+package dto
+
+type CreateRoleRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	Description    string   `json:"description"`
+	Permissions    []string `json:"permissions"`
+	RequirePasskey bool     `json:"require_passkey"`
+}
+type UpdateRoleRequest struct {
+	Description    string   `json:"description"`
+	Permissions    []string `json:"permissions"`
+	RequirePasskey bool     `json:"require_passkey"`
+}
+type RoleResponse struct {
+	ID             uint     `json:"id"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Permissions    []string `json:"permissions"`
+	RequirePasskey bool     `json:"require_passkey"`
+}
+type CreatePermissionRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+type PermissionResponse struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+type AssignRolesRequest struct {
+	Roles []string `json:"roles"`
+}
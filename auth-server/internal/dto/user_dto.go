@@ -1,23 +1,91 @@
 package dto
 
+import "time"
+
+// ClientInfo describes where a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
 type LoginRequest struct {
 	UserName string `json:"user_name" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Set instead of the tokens when the user still has to pass 2FA.
+	MFARequired    bool   `json:"mfa_required,omitempty"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
+}
+
+// ImpersonationResponse carries the access token of an impersonation session.
+// There is no refresh token; the session ends at ExpiresAt at the latest.
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 type CreateUserRequest struct {
 	UserName       string `json:"user_name" binding:"required"`
+	Email          string `json:"email" binding:"omitempty,email"`
 	HashedPassword string `json:"hashed_password" binding:"required"`
 	Role           string `json:"role" binding:"required"`
 }
 type UpdateUserRequest struct {
+	Email          string `json:"email" binding:"omitempty,email"`
 	HashedPassword string `json:"hashed_password"`
 	Role           string `json:"role"`
 }
+type UpdateMeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
 type UserResponse struct {
-	ID       uint   `json:"id"`
-	UserName string `json:"user_name"`
-	Role     string `json:"role"`
+	ID               uint       `json:"id"`
+	UserName         string     `json:"user_name"`
+	Email            *string    `json:"email,omitempty"`
+	Role             string     `json:"role"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	LockedUntil      *time.Time `json:"locked_until,omitempty"`
+}
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+	// ImpersonatorID is set on sessions in which an admin acts as the user.
+	ImpersonatorID uint `json:"impersonator_id,omitempty"`
 }
@@ -0,0 +1,18 @@
+package dto
+
+import "time"
+
+type PasskeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// PasskeyLoginBeginResponse carries the options for
+// navigator.credentials.get; ChallengeID is passed back with the assertion.
+type PasskeyLoginBeginResponse struct {
+	ChallengeID string      `json:"challenge_id"`
+	Options     interface{} `json:"options"`
+}
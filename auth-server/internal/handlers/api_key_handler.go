@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	Service *services.APIKeyService
+}
+
+func NewAPIKeyHandler(service *services.APIKeyService) *APIKeyHandler {
+	if service == nil {
+		panic("api key service cannot be nil")
+	}
+	return &APIKeyHandler{Service: service}
+}
+
+// GetMyKeys lists the calling user's API keys.
+func (h *APIKeyHandler) GetMyKeys(c *gin.Context) {
+	keys, err := h.Service.List(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get api keys: %v", err)})
+		return
+	}
+
+	resp := []dto.APIKeyResponse{}
+	for _, key := range keys {
+		resp = append(resp, toAPIKeyResponse(key, ""))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get api keys successfully",
+		"data":    resp,
+	})
+}
+
+// CreateKey requires an interactive login, enforced by the route with
+// middleware.DenyAPIKey: a key cannot mint further keys.
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	var req dto.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	key, plain, err := h.Service.Create(c.Request.Context(), c.GetUint("user_id"), &req)
+	if errors.Is(err, services.ErrScopeNotGranted) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("create api key failed: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("create api key failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created successfully, it will not be shown again",
+		"data":    toAPIKeyResponse(key, plain),
+	})
+}
+
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	err = h.Service.Revoke(c.Request.Context(), c.GetUint("user_id"), uint(id))
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("revoke api key failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked successfully",
+	})
+}
+
+func toAPIKeyResponse(key *models.APIKey, plain string) dto.APIKeyResponse {
+	return dto.APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+		Key:        plain,
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	Service *services.AuditService
+}
+
+func NewAuditHandler(service *services.AuditService) *AuditHandler {
+	if service == nil {
+		panic("audit service cannot be nil")
+	}
+	return &AuditHandler{Service: service}
+}
+
+// GetEvents lists audit events, newest first. Filters: actor_id, target_id,
+// action, result, since and until (RFC 3339), before_id for paging and limit.
+func (h *AuditHandler) GetEvents(c *gin.Context) {
+	filter, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid filter: %v", err)})
+		return
+	}
+	events, err := h.Service.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get audit events: %v", err)})
+		return
+	}
+
+	resp := []dto.AuditEventResponse{}
+	for _, event := range events {
+		resp = append(resp, toAuditEventResponse(event))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get audit events successfully",
+		"data":    resp,
+	})
+}
+
+// Verify checks the hash chain of the whole audit log.
+func (h *AuditHandler) Verify(c *gin.Context) {
+	resp, err := h.Service.Verify(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to verify audit log: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Audit log verified",
+		"data":    resp,
+	})
+}
+
+func auditFilter(c *gin.Context) (repository.AuditEventFilter, error) {
+	filter := repository.AuditEventFilter{Action: c.Query("action"), Result: c.Query("result")}
+	ids := map[string]*uint{"actor_id": &filter.ActorID, "target_id": &filter.TargetID, "before_id": &filter.BeforeID}
+	for name, dst := range ids {
+		if v := c.Query(name); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return filter, fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = uint(id)
+		}
+	}
+	times := map[string]**time.Time{"since": &filter.Since, "until": &filter.Until}
+	for name, dst := range times {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = &t
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("limit: %w", err)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+func toAuditEventResponse(event *models.AuditEvent) dto.AuditEventResponse {
+	return dto.AuditEventResponse{
+		ID:        event.ID,
+		CreatedAt: event.CreatedAt,
+		ActorID:   event.ActorID,
+		ActorName: event.ActorName,
+		TargetID:  event.TargetID,
+		Action:    event.Action,
+		Result:    event.Result,
+		IP:        event.IP,
+		UserAgent: event.UserAgent,
+		Diff:      json.RawMessage(event.Diff),
+		PrevHash:  event.PrevHash,
+		Hash:      event.Hash,
+	}
+}
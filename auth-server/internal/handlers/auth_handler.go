@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"auth-server/internal/dto"
 	"auth-server/internal/services"
@@ -31,8 +34,13 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "UserName and HashedPassword are required"})
 		return
 	}
-	fmt.Printf("Dữ liệu nhận được: %+v\n", req)
-	resp, err := h.Service.Login(c.Request.Context(), &req)
+	resp, err := h.Service.Login(c.Request.Context(), &req, clientInfo(c))
+	var locked *services.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(locked.RetrySeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
 		return
@@ -40,22 +48,147 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
-func (h *AuthHandler) Logout(c *gin.Context) {
-	token := c.GetHeader("Authorization")
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req dto.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	resp, err := h.Service.LoginTwoFactor(c.Request.Context(), &req, clientInfo(c))
+	var locked *services.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(locked.RetrySeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
 		return
 	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	if len(token) <= 7 || token[:7] != "Bearer " {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token format"})
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req dto.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
 		return
 	}
+	resp, err := h.Service.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("refresh failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	token = token[7:] // trim "Bearer " prefix
-	if err := h.Service.Logout(c.Request.Context(), token); err != nil {
+// JWKS publishes the public keys used to verify access tokens.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Service.Keys.JWKS())
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	err := h.Service.Logout(c.Request.Context(), c.GetUint("user_id"), c.GetString("session_id"), clientInfo(c))
+	if errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("logout failed: %v", err)})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("logout failed: %v", err)})
 		return
 	}
 	c.Status(http.StatusOK)
 }
+
+// Verify is the forward-auth endpoint for reverse proxies (nginx
+// auth_request, Traefik ForwardAuth). It runs behind JWTAuthMiddleware and
+// passes the caller on in X-User-* headers. Optional query parameters narrow
+// it per route: any one of the "role" values, and every "permission" value.
+// API keys have no role, so they only pass permission checks.
+func (h *AuthHandler) Verify(c *gin.Context) {
+	if roles := c.QueryArray("role"); len(roles) > 0 && !containsString(roles, c.GetString("role")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "role " + strings.Join(roles, " or ") + " required"})
+		return
+	}
+	for _, perm := range c.QueryArray("permission") {
+		if !services.HasPermission(c.GetStringSlice("permissions"), perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission " + perm + " required"})
+			return
+		}
+	}
+
+	userID := c.GetUint("user_id")
+	name, err := h.Service.UserName(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrInvalidToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to verify token: %v", err)})
+		return
+	}
+	c.Header("X-User-Id", strconv.FormatUint(uint64(userID), 10))
+	c.Header("X-User-Role", c.GetString("role"))
+	c.Header("X-User-Name", name)
+	if actorID := c.GetUint("actor_id"); actorID != 0 {
+		c.Header("X-Actor-Id", strconv.FormatUint(uint64(actorID), 10))
+	}
+	c.Status(http.StatusOK)
+}
+
+// Impersonate lets a holder of users:impersonate act as the user :id. The
+// returned token is used like a login token until EndImpersonation.
+func (h *AuthHandler) Impersonate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	resp, err := h.Service.Impersonate(c.Request.Context(), c.GetUint("user_id"), uint(id), clientInfo(c))
+	switch {
+	case errors.Is(err, services.ErrImpersonationTarget):
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("impersonation failed: %v", err)})
+		return
+	case errors.Is(err, services.ErrImpersonateSelf), errors.Is(err, services.ErrImpersonateAdmin), errors.Is(err, services.ErrImpersonateStronger):
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("impersonation failed: %v", err)})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("impersonation failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Impersonation started",
+		"data":    resp,
+	})
+}
+
+// EndImpersonation is called with the impersonation token and revokes it.
+func (h *AuthHandler) EndImpersonation(c *gin.Context) {
+	err := h.Service.EndImpersonation(c.Request.Context(), c.GetString("session_id"), clientInfo(c))
+	if errors.Is(err, services.ErrNotImpersonating) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("end impersonation failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Impersonation ended",
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func clientInfo(c *gin.Context) dto.ClientInfo {
+	return dto.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
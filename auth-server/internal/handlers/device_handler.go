@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body>
+  <h2>Connect a device</h2>
+  {{if .Done}}
+  <p>{{.Done}} You can close this window.</p>
+  {{else}}
+  {{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+  <p>Enter the code shown by the device and sign in to approve it.</p>
+  <form method="POST" action="/device">
+    <p><input name="user_code" value="{{.UserCode}}" placeholder="XXXX-XXXX" autocomplete="off" required></p>
+    <p><input name="user_name" placeholder="Username" autocomplete="username" required></p>
+    <p><input name="password" type="password" placeholder="Password" autocomplete="current-password" required></p>
+    <p><input name="otp" placeholder="2FA code (if enabled)" autocomplete="one-time-code"></p>
+    <p>
+      <button type="submit" name="action" value="approve">Approve</button>
+      <button type="submit" name="action" value="deny">Deny</button>
+    </p>
+  </form>
+  {{end}}
+</body>
+</html>`))
+
+type devicePage struct {
+	UserCode string
+	Error    string
+	Done     string
+}
+
+// DeviceAuthorization is the RFC 8628 device authorization endpoint.
+func (h *OIDCHandler) DeviceAuthorization(c *gin.Context) {
+	var req dto.DeviceAuthorizationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		writeOAuthError(c, &services.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	client, err := h.Service.AuthenticateClient(c.Request.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	resp, err := h.Service.DeviceAuthorization(c.Request.Context(), client, req.Scope)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeviceForm renders the page where users enter the code shown by the
+// device. verification_uri_complete pre-fills it.
+func (h *OIDCHandler) DeviceForm(c *gin.Context) {
+	renderDevicePage(c, http.StatusOK, devicePage{UserCode: c.Query("user_code")})
+}
+
+// DeviceVerify receives the device page. The user signs in on the form, as on
+// the authorization page, and approves or denies the device.
+func (h *OIDCHandler) DeviceVerify(c *gin.Context) {
+	userCode := c.PostForm("user_code")
+	user, err := h.Service.Authenticate(c.Request.Context(), c.PostForm("user_name"), c.PostForm("password"), c.PostForm("otp"), clientInfo(c))
+	if err != nil {
+		status := http.StatusUnauthorized
+		var locked *services.LockedError
+		if errors.As(err, &locked) {
+			status = http.StatusTooManyRequests
+			c.Header("Retry-After", strconv.Itoa(locked.RetrySeconds()))
+		}
+		renderDevicePage(c, status, devicePage{UserCode: userCode, Error: err.Error()})
+		return
+	}
+
+	approve := c.PostForm("action") == "approve"
+	err = h.Service.ApproveDevice(c.Request.Context(), userCode, user, approve, clientInfo(c))
+	if errors.Is(err, services.ErrInvalidUserCode) {
+		renderDevicePage(c, http.StatusBadRequest, devicePage{UserCode: userCode, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		renderDevicePage(c, http.StatusInternalServerError, devicePage{UserCode: userCode, Error: "failed to update the device request"})
+		return
+	}
+	done := "The device was denied access."
+	if approve {
+		done = "The device is now signed in as " + user.UserName + "."
+	}
+	renderDevicePage(c, http.StatusOK, devicePage{Done: done})
+}
+
+func renderDevicePage(c *gin.Context, status int, page devicePage) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := deviceTemplate.Execute(c.Writer, page); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// federationStateCookie holds the state of the login in progress, which the
+// callback must match.
+const federationStateCookie = "federation_state"
+
+type FederationHandler struct {
+	Service *services.FederationService
+}
+
+func NewFederationHandler(service *services.FederationService) *FederationHandler {
+	if service == nil {
+		panic("federation service cannot be nil")
+	}
+	return &FederationHandler{Service: service}
+}
+
+func (h *FederationHandler) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get identity providers successfully",
+		"data":    h.Service.Providers(),
+	})
+}
+
+// Login redirects the browser to the identity provider.
+func (h *FederationHandler) Login(c *gin.Context) {
+	url, state, err := h.Service.Begin(c.Request.Context(), c.Param("provider"))
+	if errors.Is(err, services.ErrUnknownIdentityProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("federated login failed: %v", err)})
+		return
+	}
+	// Lax, so the cookie comes along on the provider's redirect back.
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(federationStateCookie, state, 0, "/api/federation", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, url)
+}
+
+// Callback is the redirect_url registered at the provider. It answers with
+// the same tokens as /api/login.
+func (h *FederationHandler) Callback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("federated login failed: %s: %s", errCode, c.Query("error_description"))})
+		return
+	}
+	browserState, _ := c.Cookie(federationStateCookie)
+	resp, err := h.Service.Complete(c.Request.Context(), c.Param("provider"), c.Query("code"), c.Query("state"), browserState, clientInfo(c))
+	if errors.Is(err, services.ErrFederationBrowser) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("federated login failed: %v", err)})
+		return
+	}
+	if errors.Is(err, services.ErrUnknownIdentityProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidFederationState) || errors.Is(err, services.ErrFederatedLogin) || errors.Is(err, services.ErrUnknownRole) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("federated login failed: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("federated login failed: %v", err)})
+		return
+	}
+	c.SetCookie(federationStateCookie, "", -1, "/api/federation", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, resp)
+}
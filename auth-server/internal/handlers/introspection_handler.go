@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IntrospectionHandler struct {
+	Service        *services.IntrospectionService
+	ServiceClients *services.ServiceClientService
+}
+
+func NewIntrospectionHandler(service *services.IntrospectionService, serviceClients *services.ServiceClientService) *IntrospectionHandler {
+	if service == nil {
+		panic("introspection service cannot be nil")
+	}
+	if serviceClients == nil {
+		panic("service client service cannot be nil")
+	}
+	return &IntrospectionHandler{Service: service, ServiceClients: serviceClients}
+}
+
+// Introspect implements RFC 7662. Callers authenticate as a service client.
+func (h *IntrospectionHandler) Introspect(c *gin.Context) {
+	req, client := h.bind(c)
+	if client == nil {
+		return
+	}
+	resp, err := h.Service.Introspect(c.Request.Context(), req.Token, req.TokenTypeHint)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke implements RFC 7009. It answers 200 for unknown tokens too, so
+// callers cannot probe which tokens exist.
+func (h *IntrospectionHandler) Revoke(c *gin.Context) {
+	req, client := h.bind(c)
+	if client == nil {
+		return
+	}
+	if err := h.Service.Revoke(c.Request.Context(), client, req.Token, req.TokenTypeHint); err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// bind parses the form and authenticates the calling client, from HTTP Basic
+// or the client_id/client_secret form fields. It writes the error response
+// and returns a nil client on failure.
+func (h *IntrospectionHandler) bind(c *gin.Context) (*dto.IntrospectionRequest, *models.ServiceClient) {
+	var req dto.IntrospectionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		writeOAuthError(c, &services.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return nil, nil
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+	client, err := h.ServiceClients.Authenticate(c.Request.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		writeOAuthError(c, err)
+		return nil, nil
+	}
+	if req.Token == "" {
+		writeOAuthError(c, &services.OAuthError{Code: "invalid_request", Description: "token is required"})
+		return nil, nil
+	}
+	return &req, client
+}
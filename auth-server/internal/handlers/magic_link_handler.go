@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// magicLinkDeviceCookie binds a login link to the browser that requested it.
+// Other clients send the device token in the magicLinkDeviceHeader instead.
+const (
+	magicLinkDeviceCookie = "magic_link_device"
+	magicLinkDeviceHeader = "X-Magic-Link-Device"
+)
+
+type MagicLinkHandler struct {
+	Service *services.MagicLinkService
+}
+
+func NewMagicLinkHandler(service *services.MagicLinkService) *MagicLinkHandler {
+	if service == nil {
+		panic("magic link service cannot be nil")
+	}
+	return &MagicLinkHandler{Service: service}
+}
+
+// Request always answers 202 so it cannot be used to find out which email
+// addresses have an account.
+func (h *MagicLinkHandler) Request(c *gin.Context) {
+	var req dto.MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	deviceToken, err := h.Service.Request(c.Request.Context(), req.Email)
+	if err != nil {
+		log.Printf("login link request failed: %v", err)
+	}
+	if deviceToken == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login link request failed"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkDeviceCookie, deviceToken, 0, "/api/login/magic", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If an account uses this email, a login link has been sent",
+		"data":    gin.H{"device_token": deviceToken},
+	})
+}
+
+// Verify is where the emailed link points. It answers with the same tokens as
+// /api/login.
+func (h *MagicLinkHandler) Verify(c *gin.Context) {
+	deviceToken := c.GetHeader(magicLinkDeviceHeader)
+	if deviceToken == "" {
+		deviceToken, _ = c.Cookie(magicLinkDeviceCookie)
+	}
+
+	resp, err := h.Service.Verify(c.Request.Context(), c.Query("token"), deviceToken, clientInfo(c))
+	if errors.Is(err, services.ErrMagicLinkDevice) || errors.Is(err, services.ErrMagicLinkRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
+		return
+	}
+	var locked *services.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(locked.RetrySeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidMagicLink) || errors.Is(err, services.ErrPasskeyRequired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
+		return
+	}
+	c.SetCookie(magicLinkDeviceCookie, "", -1, "/api/login/magic", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, resp)
+}
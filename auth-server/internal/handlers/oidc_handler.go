@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+  <h2>Sign in to {{.ClientName}}</h2>
+  {{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+  <form method="POST" action="/authorize">
+    <input type="hidden" name="response_type" value="{{.Req.ResponseType}}">
+    <input type="hidden" name="client_id" value="{{.Req.ClientID}}">
+    <input type="hidden" name="redirect_uri" value="{{.Req.RedirectURI}}">
+    <input type="hidden" name="scope" value="{{.Req.Scope}}">
+    <input type="hidden" name="state" value="{{.Req.State}}">
+    <input type="hidden" name="nonce" value="{{.Req.Nonce}}">
+    <input type="hidden" name="code_challenge" value="{{.Req.CodeChallenge}}">
+    <input type="hidden" name="code_challenge_method" value="{{.Req.CodeChallengeMethod}}">
+    <p><input name="user_name" placeholder="Username" autocomplete="username" required></p>
+    <p><input name="password" type="password" placeholder="Password" autocomplete="current-password" required></p>
+    <p><input name="otp" placeholder="2FA code (if enabled)" autocomplete="one-time-code"></p>
+    <p><button type="submit">Sign in</button></p>
+  </form>
+</body>
+</html>`))
+
+type authorizePage struct {
+	ClientName string
+	Error      string
+	Req        *dto.AuthorizeRequest
+}
+
+type OIDCHandler struct {
+	Service        *services.OIDCService
+	ServiceClients *services.ServiceClientService
+}
+
+func NewOIDCHandler(service *services.OIDCService, serviceClients *services.ServiceClientService) *OIDCHandler {
+	if service == nil {
+		panic("oidc service cannot be nil")
+	}
+	if serviceClients == nil {
+		panic("service client service cannot be nil")
+	}
+	return &OIDCHandler{Service: service, ServiceClients: serviceClients}
+}
+
+func (h *OIDCHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Service.Discovery())
+}
+
+// AuthorizeForm starts the authorization code flow by rendering the login page.
+func (h *OIDCHandler) AuthorizeForm(c *gin.Context) {
+	var req dto.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.String(http.StatusBadRequest, "invalid request: %v", err)
+		return
+	}
+	client, ok := h.authorizeClient(c, &req)
+	if !ok {
+		return
+	}
+	renderAuthorizePage(c, http.StatusOK, authorizePage{ClientName: client.Name, Req: &req})
+}
+
+// Authorize receives the login form and redirects back to the client with an
+// authorization code.
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	var req dto.AuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.String(http.StatusBadRequest, "invalid request: %v", err)
+		return
+	}
+	client, ok := h.authorizeClient(c, &req)
+	if !ok {
+		return
+	}
+
+	user, err := h.Service.Authenticate(c.Request.Context(), c.PostForm("user_name"), c.PostForm("password"), c.PostForm("otp"), clientInfo(c))
+	if err != nil {
+		status := http.StatusUnauthorized
+		var locked *services.LockedError
+		if errors.As(err, &locked) {
+			status = http.StatusTooManyRequests
+			c.Header("Retry-After", strconv.Itoa(locked.RetrySeconds()))
+		}
+		renderAuthorizePage(c, status, authorizePage{ClientName: client.Name, Error: err.Error(), Req: &req})
+		return
+	}
+
+	code, err := h.Service.IssueCode(c.Request.Context(), &req, user, clientInfo(c))
+	if err != nil {
+		redirectWithError(c, &req, &services.OAuthError{Code: "server_error", Description: "failed to issue authorization code"})
+		return
+	}
+	redirectToClient(c, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// authorizeClient validates the client and request parameters, writing the
+// error response itself when they are invalid.
+func (h *OIDCHandler) authorizeClient(c *gin.Context, req *dto.AuthorizeRequest) (*models.OAuthClient, bool) {
+	client, err := h.Service.LookupClient(c.Request.Context(), req.ClientID, req.RedirectURI)
+	if errors.Is(err, services.ErrUnknownClient) {
+		c.String(http.StatusBadRequest, "unknown client_id or redirect_uri")
+		return nil, false
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to load client: %v", err)
+		return nil, false
+	}
+	if oerr := h.Service.ValidateAuthorizeRequest(req); oerr != nil {
+		redirectWithError(c, req, oerr)
+		return nil, false
+	}
+	return client, true
+}
+
+func (h *OIDCHandler) Token(c *gin.Context) {
+	var req dto.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		writeOAuthError(c, &services.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+	if req.GrantType == "client_credentials" {
+		h.clientCredentials(c, &req)
+		return
+	}
+
+	client, err := h.Service.AuthenticateClient(c.Request.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	resp, err := h.Service.Token(c.Request.Context(), client, &req)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// clientCredentials issues a token to a registered service client.
+func (h *OIDCHandler) clientCredentials(c *gin.Context, req *dto.TokenRequest) {
+	client, err := h.ServiceClients.Authenticate(c.Request.Context(), req.ClientID, req.ClientSecret)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	resp, err := h.ServiceClients.IssueToken(c.Request.Context(), client, req.Scope)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	resp, err := h.Service.UserInfo(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("failed to get user info: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *OIDCHandler) GetAllClients(c *gin.Context) {
+	clients, err := h.Service.GetAllClients(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get clients: %v", err)})
+		return
+	}
+
+	resp := []dto.OAuthClientResponse{}
+	for _, client := range clients {
+		resp = append(resp, toOAuthClientResponse(client, ""))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get clients successfully",
+		"data":    resp,
+	})
+}
+
+func (h *OIDCHandler) CreateClient(c *gin.Context) {
+	var req dto.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	client, secret, err := h.Service.CreateClient(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("create client failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Client created successfully",
+		"data":    toOAuthClientResponse(client, secret),
+	})
+}
+
+func (h *OIDCHandler) DeleteClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	if err := h.Service.DeleteClient(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("delete client failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Client deleted successfully",
+	})
+}
+
+func toOAuthClientResponse(client *models.OAuthClient, secret string) dto.OAuthClientResponse {
+	return dto.OAuthClientResponse{
+		ID:           client.ID,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		RedirectURIs: strings.Fields(client.RedirectURIs),
+		Public:       client.IsPublic(),
+	}
+}
+
+func renderAuthorizePage(c *gin.Context, status int, page authorizePage) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := authorizeTemplate.Execute(c.Writer, page); err != nil {
+		c.Error(err)
+	}
+}
+
+func redirectWithError(c *gin.Context, req *dto.AuthorizeRequest, oerr *services.OAuthError) {
+	redirectToClient(c, req.RedirectURI, url.Values{
+		"error":             {oerr.Code},
+		"error_description": {oerr.Description},
+		"state":             {req.State},
+	})
+}
+
+func redirectToClient(c *gin.Context, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid redirect_uri")
+		return
+	}
+	query := target.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, target.String())
+}
+
+// writeOAuthError writes an RFC 6749 error body; any other error becomes a
+// server_error.
+func writeOAuthError(c *gin.Context, err error) {
+	var oerr *services.OAuthError
+	if !errors.As(err, &oerr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+	status := http.StatusBadRequest
+	if oerr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="auth-server"`)
+	}
+	c.JSON(status, gin.H{"error": oerr.Code, "error_description": oerr.Description})
+}
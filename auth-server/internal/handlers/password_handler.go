@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordHandler struct {
+	Service *services.PasswordResetService
+}
+
+func NewPasswordHandler(service *services.PasswordResetService) *PasswordHandler {
+	if service == nil {
+		panic("password reset service cannot be nil")
+	}
+	return &PasswordHandler{Service: service}
+}
+
+// Forgot always answers 202 so it cannot be used to find out which email
+// addresses have an account.
+func (h *PasswordHandler) Forgot(c *gin.Context) {
+	var req dto.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	if err := h.Service.Forgot(c.Request.Context(), req.Email); err != nil {
+		log.Printf("password reset request failed: %v", err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If an account uses this email, a reset link has been sent",
+	})
+}
+
+func (h *PasswordHandler) Reset(c *gin.Context) {
+	var req dto.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	err := h.Service.Reset(c.Request.Context(), req.Token, req.Password)
+	if writePasswordPolicyError(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrInvalidResetToken) || errors.Is(err, services.ErrExternalAccount) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reset password failed: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("reset password failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password reset successfully",
+	})
+}
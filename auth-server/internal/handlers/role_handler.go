@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleHandler struct {
+	Service *services.RoleService
+}
+
+func NewRoleHandler(service *services.RoleService) *RoleHandler {
+	if service == nil {
+		panic("role service cannot be nil")
+	}
+	return &RoleHandler{Service: service}
+}
+
+func (h *RoleHandler) GetAllRoles(c *gin.Context) {
+	roles, err := h.Service.GetAllRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get roles: %v", err)})
+		return
+	}
+
+	resp := []dto.RoleResponse{}
+	for _, role := range roles {
+		resp = append(resp, toRoleResponse(role))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get roles successfully",
+		"data":    resp,
+	})
+}
+
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req dto.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	role, err := h.Service.CreateRole(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("create role failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Role created successfully",
+		"data":    toRoleResponse(role),
+	})
+}
+
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	var req dto.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	role, err := h.Service.UpdateRole(c.Request.Context(), uint(id), &req)
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": fmt.Sprintf("update role failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role updated successfully",
+		"data":    toRoleResponse(role),
+	})
+}
+
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	if err := h.Service.DeleteRole(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": fmt.Sprintf("delete role failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role deleted successfully",
+	})
+}
+
+func (h *RoleHandler) GetAllPermissions(c *gin.Context) {
+	permissions, err := h.Service.GetAllPermissions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get permissions: %v", err)})
+		return
+	}
+
+	resp := []dto.PermissionResponse{}
+	for _, p := range permissions {
+		resp = append(resp, dto.PermissionResponse{ID: p.ID, Name: p.Name, Description: p.Description})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get permissions successfully",
+		"data":    resp,
+	})
+}
+
+func (h *RoleHandler) CreatePermission(c *gin.Context) {
+	var req dto.CreatePermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	p, err := h.Service.CreatePermission(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("create permission failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Permission created successfully",
+		"data":    dto.PermissionResponse{ID: p.ID, Name: p.Name, Description: p.Description},
+	})
+}
+
+func (h *RoleHandler) DeletePermission(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	if err := h.Service.DeletePermission(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": fmt.Sprintf("delete permission failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Permission deleted successfully",
+	})
+}
+
+// SetUserRoles replaces the extra roles assigned to a user.
+func (h *RoleHandler) SetUserRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	var req dto.AssignRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	diff := gin.H{"to": req.Roles}
+	if current, err := h.Service.GetUserRoles(c.Request.Context(), uint(id)); err == nil {
+		names := []string{}
+		for _, role := range current {
+			names = append(names, role.Name)
+		}
+		diff["from"] = names
+	}
+	c.Set("audit_diff", gin.H{"roles": diff})
+
+	if err := h.Service.SetUserRoles(c.Request.Context(), uint(id), req.Roles); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": fmt.Sprintf("assign roles failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Roles assigned successfully",
+	})
+}
+
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound), errors.Is(err, services.ErrPermissionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUnknownRole), errors.Is(err, services.ErrUnknownPermission):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrRoleInUse):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func toRoleResponse(role *models.Roles) dto.RoleResponse {
+	return dto.RoleResponse{
+		ID:             role.ID,
+		Name:           role.Name,
+		Description:    role.Description,
+		Permissions:    role.PermissionNames(),
+		RequirePasskey: role.RequirePasskey,
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ServiceClientHandler struct {
+	Service *services.ServiceClientService
+}
+
+func NewServiceClientHandler(service *services.ServiceClientService) *ServiceClientHandler {
+	if service == nil {
+		panic("service client service cannot be nil")
+	}
+	return &ServiceClientHandler{Service: service}
+}
+
+func (h *ServiceClientHandler) GetAllClients(c *gin.Context) {
+	clients, err := h.Service.GetAllClients(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get service clients: %v", err)})
+		return
+	}
+
+	resp := []dto.ServiceClientResponse{}
+	for _, client := range clients {
+		resp = append(resp, toServiceClientResponse(client, ""))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get service clients successfully",
+		"data":    resp,
+	})
+}
+
+func (h *ServiceClientHandler) CreateClient(c *gin.Context) {
+	var req dto.CreateServiceClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	client, secret, err := h.Service.CreateClient(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("create service client failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Service client created successfully",
+		"data":    toServiceClientResponse(client, secret),
+	})
+}
+
+func (h *ServiceClientHandler) DeleteClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	if err := h.Service.DeleteClient(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("delete service client failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Service client deleted successfully",
+	})
+}
+
+func toServiceClientResponse(client *models.ServiceClient, secret string) dto.ServiceClientResponse {
+	return dto.ServiceClientResponse{
+		ID:           client.ID,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		Scopes:       client.ScopeList(),
+	}
+}
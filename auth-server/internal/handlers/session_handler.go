@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionHandler struct {
+	Service *services.SessionService
+}
+
+func NewSessionHandler(service *services.SessionService) *SessionHandler {
+	if service == nil {
+		panic("session service cannot be nil")
+	}
+	return &SessionHandler{Service: service}
+}
+
+// GetMySessions lists the active sessions of the calling user.
+func (h *SessionHandler) GetMySessions(c *gin.Context) {
+	sessions, err := h.Service.List(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get sessions: %v", err)})
+		return
+	}
+
+	current := c.GetString("session_id")
+	resp := []dto.SessionResponse{}
+	for _, sess := range sessions {
+		resp = append(resp, dto.SessionResponse{
+			ID:             sess.ID,
+			UserAgent:      sess.UserAgent,
+			IP:             sess.IP,
+			CreatedAt:      sess.CreatedAt,
+			LastSeenAt:     sess.LastSeenAt,
+			ExpiresAt:      sess.ExpiresAt,
+			Current:        sess.ID == current,
+			ImpersonatorID: sess.ImpersonatorID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get sessions successfully",
+		"data":    resp,
+	})
+}
+
+// RevokeMySession ends one of the calling user's own sessions.
+func (h *SessionHandler) RevokeMySession(c *gin.Context) {
+	sess, err := h.Service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil || sess.UserID != c.GetUint("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	if err := h.Service.Revoke(c.Request.Context(), sess.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("revoke session failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeUserSessions lets an admin force-logout a user everywhere.
+func (h *SessionHandler) RevokeUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	if err := h.Service.RevokeAllForUser(c.Request.Context(), uint(id), ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("revoke sessions failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sessions revoked successfully",
+	})
+}
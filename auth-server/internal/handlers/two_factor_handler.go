@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TwoFactorHandler struct {
+	Service *services.TwoFactorService
+}
+
+func NewTwoFactorHandler(service *services.TwoFactorService) *TwoFactorHandler {
+	if service == nil {
+		panic("two-factor service cannot be nil")
+	}
+	return &TwoFactorHandler{Service: service}
+}
+
+func (h *TwoFactorHandler) Enroll(c *gin.Context) {
+	resp, err := h.Service.Enroll(c.Request.Context(), c.GetUint("user_id"))
+	if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("enroll failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Scan the otpauth URI and confirm with a code",
+		"data":    resp,
+	})
+}
+
+func (h *TwoFactorHandler) Confirm(c *gin.Context) {
+	var req dto.TwoFactorConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	codes, err := h.Service.Confirm(c.Request.Context(), c.GetUint("user_id"), req.Code)
+	if errors.Is(err, services.ErrInvalidTwoFactorCode) || errors.Is(err, services.ErrNoPendingEnrollment) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("confirm failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication enabled",
+		"data":    gin.H{"recovery_codes": codes},
+	})
+}
+
+// Reset lets an admin turn off 2FA for a user who lost their device.
+func (h *TwoFactorHandler) Reset(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	if err := h.Service.Reset(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("reset 2FA failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication reset successfully",
+	})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -33,9 +34,12 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 	var resp []dto.UserResponse
 	for _, user := range users {
 		resp = append(resp, dto.UserResponse{
-			ID:       user.ID,
-			UserName: user.UserName,
-			Role:     string(user.Role),
+			ID:               user.ID,
+			UserName:         user.UserName,
+			Email:            user.Email,
+			Role:             string(user.Role),
+			TwoFactorEnabled: user.TOTPEnabled,
+			LockedUntil:      user.LockedUntil,
 		})
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -56,26 +60,43 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	hashed, err := services.HashPassword(req.HashedPassword)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to hash password: %v", err)})
-		return
-	}
-
 	user := models.Users{
-		UserName:       req.UserName,
-		HashedPassword: hashed,
-		Role:           req.Role,
+		UserName: req.UserName,
+		Role:     req.Role,
+	}
+	if req.Email != "" {
+		email := services.NormalizeEmail(req.Email)
+		user.Email = &email
 	}
-	if err := h.Service.CreateUser(c.Request.Context(), &user); err != nil {
+	c.Set("audit_diff", gin.H{"user_name": user.UserName, "role": user.Role, "email": user.Email})
+	if user.Role != string(models.RoleUser) {
+		if err := services.AuthorizeUserFields(c.GetStringSlice("permissions"), false, []string{"role"}); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := h.Service.CreateUser(c.Request.Context(), &user, req.HashedPassword); err != nil {
+		if writePasswordPolicyError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("create user failed: %v", err)})
+			return
+		}
+		if errors.Is(err, services.ErrUserNameTaken) || errors.Is(err, services.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("create user failed: %v", err)})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("create user failed: %v", err)})
 		return
 	}
+	c.Set("audit_target_id", user.ID)
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User created successfully",
 		"data": dto.UserResponse{
 			ID:       user.ID,
 			UserName: user.UserName,
+			Email:    user.Email,
 			Role:     user.Role,
 		},
 	})
@@ -99,9 +120,35 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
 		return
 	}
+	if err := services.AuthorizeUserFields(c.GetStringSlice("permissions"), uint(id) != c.GetUint("user_id"), updateRequestFields(&req)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if uint(id) == c.GetUint("user_id") && req.Email != "" {
+		if err := h.Service.RequireRecentLogin(c.Request.Context(), uint(id), c.GetString("session_id")); err != nil {
+			if errors.Is(err, services.ErrReauthRequired) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+			return
+		}
+	}
 
 	updates := map[string]interface{}{}
 	if req.HashedPassword != "" {
+		user, err := h.Service.GetUserByID(c.Request.Context(), uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err := h.Service.ValidatePassword(c.Request.Context(), user, req.HashedPassword); err != nil {
+			if !writePasswordPolicyError(c, err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+			}
+			return
+		}
 		hash, err := services.HashPassword(req.HashedPassword)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to hash password: %v", err)})
@@ -112,13 +159,29 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	if req.Role != "" {
 		updates["role"] = req.Role
 	}
+	if req.Email != "" {
+		updates["email"] = services.NormalizeEmail(req.Email)
+	}
 
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
 		return
 	}
+	var before *models.Users
+	if user, err := h.Service.GetUserByID(c.Request.Context(), uint(id)); err == nil {
+		before = user
+	}
+	c.Set("audit_diff", userUpdateDiff(before, updates))
 
 	if err := h.Service.UpdateUser(c.Request.Context(), uint(id), updates); err != nil {
+		if errors.Is(err, services.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+			return
+		}
+		if errors.Is(err, services.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
 		return
 	}
@@ -140,6 +203,9 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if user, err := h.Service.GetUserByID(c.Request.Context(), uint(id)); err == nil && user != nil {
+		c.Set("audit_diff", gin.H{"user_name": user.UserName, "role": user.Role, "email": user.Email})
+	}
 	if err := h.Service.DeleteUser(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("delete user failed: %v", err)})
 		return
@@ -149,6 +215,28 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	})
 }
 
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	idStr := c.Param("id")
+	if idStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing user ID"})
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	if err := h.Service.UnlockUser(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("unlock user failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User unlocked successfully",
+	})
+}
+
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	idStr := c.Param("id")
 	if idStr == "" {
@@ -175,10 +263,161 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Get user successfully",
-		"data": dto.UserResponse{
-			ID:       user.ID,
-			UserName: user.UserName,
-			Role:     user.Role,
-		},
+		"data":    toUserResponse(user),
+	})
+}
+
+// GetMe returns the calling user's own record.
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, err := h.Service.GetUserByID(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get user: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get user successfully",
+		"data":    toUserResponse(user),
+	})
+}
+
+// UpdateMe changes the calling user's own profile. Only the email can be
+// changed here, from a recent login; the password goes through
+// ChangeMyPassword.
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	var req dto.UpdateMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	id := c.GetUint("user_id")
+	updates := map[string]interface{}{"email": services.NormalizeEmail(req.Email)}
+	user, err := h.Service.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+		return
+	}
+	c.Set("audit_target_id", id)
+	c.Set("audit_diff", userUpdateDiff(user, updates))
+
+	if err := h.Service.ChangeEmail(c.Request.Context(), id, c.GetString("session_id"), updates["email"].(string)); err != nil {
+		if errors.Is(err, services.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+			return
+		}
+		if errors.Is(err, services.ErrReauthRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update user failed: %v", err)})
+		return
+	}
+	email := updates["email"].(string)
+	user.Email = &email
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated successfully",
+		"data":    toUserResponse(user),
+	})
+}
+
+// ChangeMyPassword sets the calling user's password. It needs the current
+// password and a recent login, logs out every other session and deletes the
+// user's API keys.
+func (h *UserHandler) ChangeMyPassword(c *gin.Context) {
+	var req dto.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	id := c.GetUint("user_id")
+	c.Set("audit_target_id", id)
+	err := h.Service.ChangePassword(c.Request.Context(), id, c.GetString("session_id"), req.CurrentPassword, req.NewPassword, clientInfo(c))
+	if err != nil {
+		c.Set("audit_diff", gin.H{"reason": err.Error()})
+	}
+	if writePasswordPolicyError(c, err) {
+		return
+	}
+	var locked *services.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(locked.RetrySeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("change password failed: %v", err)})
+		return
+	}
+	if errors.Is(err, services.ErrWrongPassword) || errors.Is(err, services.ErrReauthRequired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("change password failed: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("change password failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password changed successfully",
+	})
+}
+
+func toUserResponse(user *models.Users) dto.UserResponse {
+	return dto.UserResponse{
+		ID:               user.ID,
+		UserName:         user.UserName,
+		Email:            user.Email,
+		Role:             user.Role,
+		TwoFactorEnabled: user.TOTPEnabled,
+		LockedUntil:      user.LockedUntil,
+	}
+}
+
+// updateRequestFields lists the user columns req sets.
+func updateRequestFields(req *dto.UpdateUserRequest) []string {
+	var fields []string
+	if req.HashedPassword != "" {
+		fields = append(fields, "hashed_password")
+	}
+	if req.Role != "" {
+		fields = append(fields, "role")
+	}
+	if req.Email != "" {
+		fields = append(fields, "email")
+	}
+	return fields
+}
+
+// userUpdateDiff describes updates for the audit log, with the previous
+// values when the user could be loaded. Password hashes are left out.
+func userUpdateDiff(before *models.Users, updates map[string]interface{}) gin.H {
+	diff := gin.H{}
+	if role, ok := updates["role"]; ok {
+		change := gin.H{"to": role}
+		if before != nil {
+			change["from"] = before.Role
+		}
+		diff["role"] = change
+	}
+	if email, ok := updates["email"]; ok {
+		change := gin.H{"to": email}
+		if before != nil {
+			change["from"] = before.Email
+		}
+		diff["email"] = change
+	}
+	if _, ok := updates["hashed_password"]; ok {
+		diff["password"] = "changed"
+	}
+	return diff
+}
+
+// writePasswordPolicyError answers 422 with the failed rules if err is a
+// password policy violation, and reports whether it did.
+func writePasswordPolicyError(c *gin.Context, err error) bool {
+	var perr *services.PasswordPolicyError
+	if !errors.As(err, &perr) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":      "password does not meet the password policy",
+		"violations": perr.Violations,
 	})
+	return true
 }
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebAuthnHandler struct {
+	Service *services.WebAuthnService
+}
+
+func NewWebAuthnHandler(service *services.WebAuthnService) *WebAuthnHandler {
+	if service == nil {
+		panic("webauthn service cannot be nil")
+	}
+	return &WebAuthnHandler{Service: service}
+}
+
+// BeginRegistration returns the options to pass to navigator.credentials.create.
+// Like API keys, passkeys can only be added from an interactive login, which
+// the route enforces with middleware.DenyAPIKey.
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	options, err := h.Service.BeginRegistration(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("begin passkey registration failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Passkey registration started",
+		"data":    options,
+	})
+}
+
+// FinishRegistration takes the authenticator's response as the request body;
+// the passkey's display name is given in the "name" query parameter.
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	credential, err := h.Service.FinishRegistration(c.Request.Context(), c.GetUint("user_id"), c.Query("name"), body)
+	if errors.Is(err, services.ErrInvalidCeremony) || errors.Is(err, services.ErrInvalidPasskey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("passkey registration failed: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("passkey registration failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Passkey registered successfully",
+		"data":    toPasskeyResponse(credential),
+	})
+}
+
+// GetMyPasskeys lists the calling user's passkeys.
+func (h *WebAuthnHandler) GetMyPasskeys(c *gin.Context) {
+	credentials, err := h.Service.List(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get passkeys: %v", err)})
+		return
+	}
+
+	resp := []dto.PasskeyResponse{}
+	for _, credential := range credentials {
+		resp = append(resp, toPasskeyResponse(credential))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Get passkeys successfully",
+		"data":    resp,
+	})
+}
+
+func (h *WebAuthnHandler) DeletePasskey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ID format: %v", err)})
+		return
+	}
+
+	err = h.Service.Delete(c.Request.Context(), c.GetUint("user_id"), uint(id))
+	if errors.Is(err, services.ErrPasskeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "passkey not found"})
+		return
+	}
+	if errors.Is(err, services.ErrLastPasskey) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("delete passkey failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Passkey deleted successfully",
+	})
+}
+
+// BeginLogin returns the options to pass to navigator.credentials.get. No
+// user name is needed: the authenticator offers the passkeys it holds.
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	challengeID, options, err := h.Service.BeginLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("begin passkey login failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, dto.PasskeyLoginBeginResponse{ChallengeID: challengeID, Options: options})
+}
+
+// FinishLogin takes the assertion as the request body and the challenge_id
+// from BeginLogin as a query parameter. It answers with the same tokens as
+// /api/login.
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	resp, err := h.Service.FinishLogin(c.Request.Context(), c.Query("challenge_id"), body, clientInfo(c))
+	if errors.Is(err, services.ErrInvalidCeremony) || errors.Is(err, services.ErrInvalidPasskey) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("login failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func toPasskeyResponse(credential *models.WebAuthnCredential) dto.PasskeyResponse {
+	return dto.PasskeyResponse{
+		ID:         credential.ID,
+		Name:       credential.Name,
+		Transports: credential.TransportList(),
+		LastUsedAt: credential.LastUsedAt,
+		CreatedAt:  credential.CreatedAt,
+	}
+}
@@ -0,0 +1,228 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"auth-server/internal/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a private signing key together with the JWT algorithm it is used with.
+type Key struct {
+	ID        string
+	Algorithm string
+	private   crypto.Signer
+	method    jwt.SigningMethod
+}
+
+// KeySet holds every key that tokens may still be signed with. Only the active
+// key signs new tokens; the others stay around for verification and are still
+// published in the JWKS until they are removed from config.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+	order  []*Key
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Load reads the signing keys listed in config. A key file that does not exist
+// yet is generated, which keeps local and docker setups working out of the box.
+func Load(cfg config.JWTConfig) (*KeySet, error) {
+	if len(cfg.SigningKeys) == 0 {
+		return nil, errors.New("jwt.signing_keys must contain at least one key")
+	}
+
+	set := &KeySet{keys: map[string]*Key{}}
+	for _, kc := range cfg.SigningKeys {
+		if kc.ID == "" {
+			return nil, errors.New("signing key is missing kid")
+		}
+		if _, dup := set.keys[kc.ID]; dup {
+			return nil, fmt.Errorf("duplicate signing key kid %q", kc.ID)
+		}
+		key, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", kc.ID, err)
+		}
+		set.keys[key.ID] = key
+		set.order = append(set.order, key)
+	}
+
+	activeID := cfg.ActiveKey
+	if activeID == "" {
+		activeID = cfg.SigningKeys[0].ID
+	}
+	active, ok := set.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q is not configured", activeID)
+	}
+	set.active = active
+	return set, nil
+}
+
+// Sign signs the claims with the active key and sets the kid header.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.private)
+}
+
+// Keyfunc resolves the verification key for a token from its kid header. It is
+// meant to be passed to jwt.Parse / jwt.ParseWithClaims.
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return key.private.Public(), nil
+}
+
+// JWKS returns the public half of every configured key.
+func (s *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range s.order {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func loadKey(kc config.SigningKeyConfig) (*Key, error) {
+	var method jwt.SigningMethod
+	switch kc.Algorithm {
+	case AlgRS256:
+		method = jwt.SigningMethodRS256
+	case AlgEdDSA:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", kc.Algorithm)
+	}
+
+	data, err := os.ReadFile(kc.PrivateKeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = generateKeyFile(kc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	key := &Key{ID: kc.ID, Algorithm: kc.Algorithm, method: method}
+	switch pk := parsed.(type) {
+	case *rsa.PrivateKey:
+		if kc.Algorithm != AlgRS256 {
+			return nil, errors.New("RSA key configured with a non-RSA algorithm")
+		}
+		key.private = pk
+	case ed25519.PrivateKey:
+		if kc.Algorithm != AlgEdDSA {
+			return nil, errors.New("Ed25519 key configured with a non-EdDSA algorithm")
+		}
+		key.private = pk
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return key, nil
+}
+
+func generateKeyFile(kc config.SigningKeyConfig) ([]byte, error) {
+	var private interface{}
+	var err error
+	switch kc.Algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if err := os.MkdirAll(filepath.Dir(kc.PrivateKeyFile), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(kc.PrivateKeyFile, data, 0o600); err != nil {
+		return nil, err
+	}
+	log.Printf("generated new %s signing key %q at %s", kc.Algorithm, kc.ID, kc.PrivateKeyFile)
+	return data, nil
+}
+
+// Algorithms lists the distinct signing algorithms in use.
+func (s *KeySet) Algorithms() []string {
+	var algs []string
+	seen := map[string]bool{}
+	for _, key := range s.order {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+	return algs
+}
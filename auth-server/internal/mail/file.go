@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+)
+
+// FileMailer is meant for local development: it appends messages to a file,
+// or writes them to the log when no path is set.
+type FileMailer struct {
+	from string
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(from, path string) *FileMailer {
+	return &FileMailer{from: from, path: path}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data := formatMessage(m.from, msg)
+	if m.path == "" {
+		log.Printf("mail to %s:\n%s", msg.To, data)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, "\r\n\r\n"...)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+// Package mail delivers outgoing email through a configurable backend.
+package mail
+
+import (
+	"auth-server/internal/config"
+	"context"
+	"fmt"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends a plain-text message.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New builds the Mailer selected by cfg.Driver.
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("mail: smtp driver requires smtp.host")
+		}
+		return NewSMTPMailer(cfg.From, cfg.SMTP), nil
+	case "file", "":
+		return NewFileMailer(cfg.From, cfg.File), nil
+	}
+	return nil, fmt.Errorf("mail: unknown driver %q", cfg.Driver)
+}
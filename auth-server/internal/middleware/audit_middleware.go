@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"auth-server/internal/dto"
+	"auth-server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit records the request in the audit log under action once the rest of
+// the chain has run, so put it before any permission check to also record
+// denied attempts. The target is the :id route parameter unless the handler
+// set "audit_target_id"; handlers describe the change in "audit_diff".
+// Requests made while impersonating are recorded under the admin.
+func Audit(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		entry := services.AuditEntry{
+			ActorID: c.GetUint("user_id"),
+			Action:  action,
+			Success: status < http.StatusBadRequest,
+			Client:  dto.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()},
+		}
+		if id, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+			entry.TargetID = uint(id)
+		}
+		if id := c.GetUint("audit_target_id"); id != 0 {
+			entry.TargetID = id
+		}
+		if diff, ok := c.Get("audit_diff"); ok {
+			entry.Diff = diff
+		} else if !entry.Success {
+			entry.Diff = gin.H{"status": status}
+		}
+		if actorID := c.GetUint("actor_id"); actorID != 0 {
+			entry.ActorID = actorID
+			entry.Diff = gin.H{"impersonating": c.GetUint("user_id"), "change": entry.Diff}
+		}
+		AuditService.Record(c.Request.Context(), entry)
+	}
+}
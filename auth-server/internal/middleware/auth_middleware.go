@@ -1,56 +1,188 @@
 package middleware
 
 import (
-	"auth-server/internal/config"
 	"auth-server/internal/models"
-	"context"
+	"auth-server/internal/services"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
-	"github.com/golang-jwt/jwt/v4"
 )
 
-type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-var RedisClient *redis.Client
+var AuthService *services.AuthService
+var APIKeyService *services.APIKeyService
+var ServiceClientService *services.ServiceClientService
+var AuditService *services.AuditService
+var RoleService *services.RoleService
 
-func InitMiddleware(redis *redis.Client) {
-	RedisClient = redis
+func InitMiddleware(authService *services.AuthService, apiKeyService *services.APIKeyService, serviceClientService *services.ServiceClientService, auditService *services.AuditService, roleService *services.RoleService) {
+	AuthService = authService
+	APIKeyService = apiKeyService
+	ServiceClientService = serviceClientService
+	AuditService = auditService
+	RoleService = roleService
 }
+
+// JWTAuthMiddleware authenticates "Authorization: Bearer <jwt>" and
+// "Authorization: ApiKey <key>". Both set user_id and permissions; JWTs also
+// set role and session_id, and API keys set api_key_id but no role, so role
+// checks never pass for them. Routes that manage sessions or credentials
+// refuse API keys with DenyAPIKey. Impersonation tokens set actor_id to the
+// admin acting as user_id.
 func JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if strings.HasPrefix(authHeader, "ApiKey ") {
+			apiKeyAuth(c, strings.TrimPrefix(authHeader, "ApiKey "))
+			return
+		}
 		if !strings.HasPrefix(authHeader, "Bearer ") {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
 			return
 		}
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
-		token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.AppConfig.JWT.Secret), nil
-		})
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		// Checks the signature and that the token's session is still active.
+		claims, err := AuthService.VerifyAccessToken(c.Request.Context(), tokenStr)
+		if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrSessionRevoked) || errors.Is(err, services.ErrTokenOutdated) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
-
-		// Check Redis for token validity
-		redisKey := "token:" + tokenStr
-		exists, err := RedisClient.Exists(context.Background(), redisKey).Result()
-		if err != nil || exists == 0 {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token expired or logged out"})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to verify token"})
 			return
 		}
 
-		claims := token.Claims.(*Claims)
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("permissions", claims.Permissions)
+		c.Set("session_id", claims.SessionID)
+		if claims.Actor != nil {
+			c.Set("actor_id", claims.Actor.UserID)
+		}
+		c.Next()
+	}
+}
+
+func apiKeyAuth(c *gin.Context, key string) {
+	principal, err := APIKeyService.Authenticate(c.Request.Context(), key)
+	if errors.Is(err, services.ErrInvalidAPIKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to verify api key"})
+		return
+	}
+
+	c.Set("user_id", principal.UserID)
+	c.Set("permissions", principal.Permissions)
+	c.Set("api_key_id", principal.KeyID)
+	c.Next()
+}
+
+// ClientAuthMiddleware authenticates service clients by the Bearer tokens of
+// the client_credentials grant, setting client_id and scopes.
+func ClientAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+			return
+		}
+
+		claims, err := ServiceClientService.VerifyToken(c.Request.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+		if errors.Is(err, services.ErrInvalidToken) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to verify token"})
+			return
+		}
+
+		c.Set("client_id", claims.ClientID)
+		c.Set("scopes", claims.Scopes())
+		c.Next()
+	}
+}
+
+// RequireScope allows the request only if the service client's token was
+// granted every one of scopes.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("scopes")
+		for _, scope := range scopes {
+			if !services.HasScope(granted, scope) {
+				c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "scope " + scope + " required"})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission allows the request only if the caller's token grants perm,
+// directly or through the "*" or "resource:*" wildcards.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !services.HasPermission(c.GetStringSlice("permissions"), perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission " + perm + " required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuthorizeUser applies services.AuthorizeUserAction to a /api/users route;
+// the target is the :id route parameter, if any.
+func AuthorizeUser(action services.UserAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var targetID uint
+		if id, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+			targetID = uint(id)
+		}
+		callerID := c.GetUint("user_id")
+		var targetPermissions []string
+		if services.ChangesUser(action) && targetID != 0 && targetID != callerID {
+			perms, err := RoleService.PermissionsForUser(c.Request.Context(), targetID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+				return
+			}
+			targetPermissions = perms
+		}
+		if err := services.AuthorizeUserAction(c.GetStringSlice("permissions"), callerID, c.GetUint("api_key_id") != 0, action, targetID, targetPermissions); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyImpersonation refuses the request when an admin is impersonating the
+// caller; put it on actions only the user themselves may take.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("actor_id") != 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating a user"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyAPIKey refuses requests authenticated by an API key; put it on actions
+// that must be taken by the person logged in.
+func DenyAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("api_key_id") != 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed with an api key"})
+			return
+		}
 		c.Next()
 	}
 }
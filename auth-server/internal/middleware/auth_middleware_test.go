@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-server/internal/config"
+	"auth-server/internal/keys"
+	"auth-server/internal/models"
+	"auth-server/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func setupServiceClients(t *testing.T) *services.ServiceClientService {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{
+		JWT: config.JWTConfig{SigningKeys: []config.SigningKeyConfig{
+			{ID: "test", Algorithm: "EdDSA", PrivateKeyFile: t.TempDir() + "/test.pem"},
+		}},
+		ClientCredentials: config.ClientCredentialsConfig{TokenExpiration: 60},
+	}
+	keySet, err := keys.Load(config.AppConfig.JWT)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	clients := services.NewServiceClientService(nil, services.NewTokenDenylist(rdb), keySet)
+	InitMiddleware(nil, nil, clients, nil, nil)
+	return clients
+}
+
+func TestRequireScope(t *testing.T) {
+	clients := setupServiceClients(t)
+	client := &models.ServiceClient{ClientID: "billing", Scopes: "users:read sessions:revoke"}
+
+	r := gin.New()
+	r.GET("/users/:id", ClientAuthMiddleware(), RequireScope("users:read"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		token  func() string
+		status int
+	}{
+		{"no token", func() string { return "" }, http.StatusUnauthorized},
+		{"invalid token", func() string { return "Bearer nope" }, http.StatusUnauthorized},
+		{"scope granted", func() string { return issue(t, clients, client, "users:read") }, http.StatusOK},
+		{"all client scopes", func() string { return issue(t, clients, client, "") }, http.StatusOK},
+		{"wrong scope", func() string { return issue(t, clients, client, "sessions:revoke") }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			if token := tt.token(); token != "" {
+				req.Header.Set("Authorization", token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusForbidden && w.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("403 without WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func issue(t *testing.T, clients *services.ServiceClientService, client *models.ServiceClient, scope string) string {
+	t.Helper()
+	resp, err := clients.IssueToken(context.Background(), client, scope)
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	return "Bearer " + resp.AccessToken
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// AuditEvent is an entry of the security audit log. Entries are never
+// updated or deleted. Each one stores the hash of the previous entry and its
+// own hash over both, so editing, removing or reordering entries breaks the
+// chain.
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index;not null"`
+	// ActorID is nil when the actor is not a known user, e.g. a failed login
+	// with an unknown name; ActorName is what they called themselves.
+	ActorID   *uint  `gorm:"index"`
+	ActorName string `gorm:"not null;default:''"`
+	TargetID  *uint  `gorm:"index"`
+	Action    string `gorm:"index;not null"`
+	Result    string `gorm:"not null"`
+	IP        string `gorm:"not null;default:''"`
+	UserAgent string `gorm:"not null;default:''"`
+	// Diff is a JSON object describing the change, or details of the event.
+	Diff     string `gorm:"type:json;not null;default:'{}'"`
+	PrevHash string `gorm:"not null"`
+	Hash     string `gorm:"uniqueIndex;not null"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// ComputeHash hashes the event's fields together with PrevHash. CreatedAt is
+// taken in UTC microseconds, the precision Postgres stores.
+func (e *AuditEvent) ComputeHash() string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%d\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n",
+		e.PrevHash,
+		e.CreatedAt.UTC().UnixMicro(),
+		optionalID(e.ActorID),
+		e.ActorName,
+		optionalID(e.TargetID),
+		e.Action,
+		e.Result,
+		e.IP,
+		e.UserAgent,
+		e.Diff,
+	)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func optionalID(id *uint) string {
+	if id == nil {
+		return "-"
+	}
+	return fmt.Sprint(*id)
+}
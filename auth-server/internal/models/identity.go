@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Identity links a local user to an account at an external OIDC provider,
+// identified by the provider's name and its sub claim.
+type Identity struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"index;not null"`
+	User        *Users `gorm:"constraint:OnDelete:CASCADE"`
+	Provider    string `gorm:"uniqueIndex:idx_identities_provider_subject;not null"`
+	Subject     string `gorm:"uniqueIndex:idx_identities_provider_subject;not null"`
+	Email       string
+	LastLoginAt *time.Time
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+func (Identity) TableName() string {
+	return "identities"
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuthClient is an application registered to use auth-server as its OpenID
+// Connect provider. Public clients (no secret) must rely on PKCE alone.
+type OAuthClient struct {
+	ID           uint      `gorm:"primaryKey"`
+	ClientID     string    `gorm:"uniqueIndex;not null"`
+	Name         string    `gorm:"not null"`
+	HashedSecret string    // empty for public clients
+	RedirectURIs string    `gorm:"not null"` // space separated
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+func (c *OAuthClient) IsPublic() bool {
+	return c.HashedSecret == ""
+}
+
+// AllowsRedirect reports whether uri exactly matches a registered redirect URI.
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	for _, allowed := range strings.Fields(c.RedirectURIs) {
+		if allowed == uri {
+			return true
+		}
+	}
+	return false
+}
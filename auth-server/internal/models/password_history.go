@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PasswordHistory keeps the hashes of a user's previous passwords so they
+// cannot be reused.
+type PasswordHistory struct {
+	ID             uint      `gorm:"primaryKey"`
+	UserID         uint      `gorm:"index;not null"`
+	HashedPassword string    `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_histories"
+}
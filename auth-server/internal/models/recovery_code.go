@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RecoveryCode is a one-time code that can stand in for a TOTP code. Codes
+// are random, so HashedCode is a plain SHA-256 that can be looked up.
+type RecoveryCode struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index;not null"`
+	HashedCode string `gorm:"index;not null"`
+	UsedAt     *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// PermissionAll grants every permission; "resource:*" grants every action on
+// one resource.
+const PermissionAll = "*"
+
+// Roles is a named set of permissions. A user's primary role is the
+// Users.Role column; further roles can be assigned through user_roles.
+type Roles struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"uniqueIndex;not null"`
+	Description string
+	// RequirePasskey makes members sign in with a WebAuthn passkey once they
+	// have registered one.
+	RequirePasskey bool           `gorm:"not null;default:false"`
+	Permissions    []*Permissions `gorm:"many2many:role_permissions;joinForeignKey:RoleID;joinReferences:PermissionID"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime"`
+}
+
+func (Roles) TableName() string {
+	return "roles"
+}
+
+// Permissions are named "resource:action", e.g. "users:write".
+type Permissions struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"uniqueIndex;not null"`
+	Description string
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+func (Permissions) TableName() string {
+	return "permissions"
+}
+
+// PermissionNames returns the names of the role's permissions.
+func (r *Roles) PermissionNames() []string {
+	names := make([]string, 0, len(r.Permissions))
+	for _, p := range r.Permissions {
+		names = append(names, p.Name)
+	}
+	return names
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ServiceClient is a backend service that obtains tokens for itself with the
+// client_credentials grant.
+type ServiceClient struct {
+	ID           uint      `gorm:"primaryKey"`
+	ClientID     string    `gorm:"uniqueIndex;not null"`
+	Name         string    `gorm:"not null"`
+	HashedSecret string    `gorm:"not null"`
+	Scopes       string    `gorm:"not null"` // space separated
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (ServiceClient) TableName() string {
+	return "service_clients"
+}
+
+func (c *ServiceClient) ScopeList() []string {
+	return strings.Fields(c.Scopes)
+}
+
+func (c *ServiceClient) AllowsScope(scope string) bool {
+	for _, allowed := range c.ScopeList() {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
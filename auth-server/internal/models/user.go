@@ -1,6 +1,7 @@
 package models
 
 import (
+	"log"
 	"time"
 
 	"gorm.io/gorm"
@@ -14,10 +15,16 @@ const (
 )
 
 type Users struct {
-	ID             uint      `gorm:"primaryKey"`
-	UserName       string    `gorm:"uniqueIndex;not null"`
-	HashedPassword string    `gorm:"not null"`
-	Role           string    `gorm:"not null"`
+	ID             uint    `gorm:"primaryKey"`
+	UserName       string  `gorm:"uniqueIndex;not null"`
+	Email          *string `gorm:"uniqueIndex"`
+	HashedPassword string  `gorm:"not null"`
+	Role           string  `gorm:"not null"`
+	TOTPSecret     string  `gorm:"column:totp_secret"`
+	TOTPEnabled    bool    `gorm:"column:totp_enabled;not null;default:false"`
+	LockedUntil    *time.Time
+	TokenVersion   int       `gorm:"not null;default:0"`
+	Roles          []*Roles  `gorm:"many2many:user_roles;joinForeignKey:UserID;joinReferences:RoleID"`
 	CreatedAt      time.Time `gorm:"autoCreateTime"`
 	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
 }
@@ -26,5 +33,21 @@ func (Users) TableName() string {
 	return "users"
 }
 func Migrate(db *gorm.DB) {
-	db.AutoMigrate(&Users{})
+	db.AutoMigrate(&Users{}, &Roles{}, &Permissions{}, &OAuthClient{}, &RecoveryCode{}, &PasswordHistory{}, &APIKey{}, &ServiceClient{}, &Identity{}, &WebAuthnCredential{}, &AuditEvent{})
+	// User names are unique ignoring case, as they are looked up at login.
+	// This replaces a plain index of the same expression; creating it fails
+	// while case-insensitive duplicates exist, which have to be renamed first.
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_user_name_lower_unique ON users (LOWER(user_name))").Error; err != nil {
+		log.Printf("failed to create unique index on lower(user_name): %v", err)
+	} else {
+		db.Exec("DROP INDEX IF EXISTS idx_users_user_name_lower")
+	}
+	// The audit log is append-only, whatever the application does.
+	db.Exec(`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END
+$$ LANGUAGE plpgsql`)
+	db.Exec("DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events")
+	db.Exec("CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only()")
 }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// WebAuthnCredential is a passkey registered by a user. SignCount is the
+// authenticator's signature counter as of its last use.
+type WebAuthnCredential struct {
+	ID              uint   `gorm:"primaryKey"`
+	UserID          uint   `gorm:"index;not null"`
+	Name            string `gorm:"not null"`
+	CredentialID    []byte `gorm:"uniqueIndex;not null"`
+	PublicKey       []byte `gorm:"not null"`
+	AttestationType string
+	Transports      string // space separated
+	AAGUID          []byte `gorm:"column:aaguid"`
+	Flags           uint8  `gorm:"not null;default:0"` // authenticator data flags
+	SignCount       uint32 `gorm:"not null;default:0"`
+	CloneWarning    bool   `gorm:"not null;default:false"`
+	LastUsedAt      *time.Time
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+func (c *WebAuthnCredential) TransportList() []string {
+	return strings.Fields(c.Transports)
+}
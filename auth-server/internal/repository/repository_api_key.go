@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"time"
+)
+
+type APIKeyRepository interface {
+	GetKeysByUserID(ctx context.Context, userID uint) ([]*models.APIKey, error)
+	GetKeyByHash(ctx context.Context, hashedKey string) (*models.APIKey, error)
+	CreateKey(ctx context.Context, key *models.APIKey) error
+	DeleteKey(ctx context.Context, userID, id uint) (bool, error)
+	DeleteKeysByUserID(ctx context.Context, userID uint) error
+	TouchKey(ctx context.Context, id uint, at time.Time) error
+}
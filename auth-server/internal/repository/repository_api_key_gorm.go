@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type apiKeyRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewAPIKeyRepositoryGorm creates a new GORM implementation of APIKeyRepository
+func NewAPIKeyRepositoryGorm(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepositoryGorm{DB: db}
+}
+
+func (r *apiKeyRepositoryGorm) GetKeysByUserID(ctx context.Context, userID uint) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	err := r.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&keys).Error
+	return keys, err
+}
+func (r *apiKeyRepositoryGorm) GetKeyByHash(ctx context.Context, hashedKey string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.DB.WithContext(ctx).Where("hashed_key = ?", hashedKey).First(&key).Error
+	return &key, err
+}
+func (r *apiKeyRepositoryGorm) CreateKey(ctx context.Context, key *models.APIKey) error {
+	return r.DB.WithContext(ctx).Create(key).Error
+}
+
+// DeleteKey removes one of the user's keys, returning false if they have no
+// key with that ID.
+func (r *apiKeyRepositoryGorm) DeleteKey(ctx context.Context, userID, id uint) (bool, error) {
+	res := r.DB.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.APIKey{})
+	return res.RowsAffected == 1, res.Error
+}
+func (r *apiKeyRepositoryGorm) DeleteKeysByUserID(ctx context.Context, userID uint) error {
+	return r.DB.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.APIKey{}).Error
+}
+func (r *apiKeyRepositoryGorm) TouchKey(ctx context.Context, id uint, at time.Time) error {
+	return r.DB.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"time"
+)
+
+// AuditEventFilter narrows ListEvents; zero fields match everything.
+type AuditEventFilter struct {
+	ActorID  uint
+	TargetID uint
+	Action   string
+	Result   string
+	Since    *time.Time
+	Until    *time.Time
+	// BeforeID pages backwards: only events with a smaller ID are returned.
+	BeforeID uint
+	Limit    int
+}
+
+// AuditEventRepository is append-only: events cannot be updated or deleted.
+type AuditEventRepository interface {
+	// AppendEvent links the event to the last one, setting PrevHash and
+	// Hash, and inserts it.
+	AppendEvent(ctx context.Context, event *models.AuditEvent) error
+	// ListEvents returns matching events, newest first.
+	ListEvents(ctx context.Context, filter AuditEventFilter) ([]*models.AuditEvent, error)
+	// EventsAfter returns up to limit events with an ID greater than afterID,
+	// in chain order.
+	EventsAfter(ctx context.Context, afterID uint, limit int) ([]*models.AuditEvent, error)
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// auditChainLock is the Postgres advisory lock that serializes appends, so
+// every event links to the one inserted before it.
+const auditChainLock = 0x61756469
+
+type auditEventRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewAuditEventRepositoryGorm creates a new GORM implementation of AuditEventRepository
+func NewAuditEventRepositoryGorm(db *gorm.DB) AuditEventRepository {
+	return &auditEventRepositoryGorm{DB: db}
+}
+
+func (r *auditEventRepositoryGorm) AppendEvent(ctx context.Context, event *models.AuditEvent) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLock).Error; err != nil {
+			return err
+		}
+		var last []*models.AuditEvent
+		if err := tx.Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		event.PrevHash = ""
+		if len(last) > 0 {
+			event.PrevHash = last[0].Hash
+		}
+		event.Hash = event.ComputeHash()
+		return tx.Create(event).Error
+	})
+}
+func (r *auditEventRepositoryGorm) ListEvents(ctx context.Context, filter AuditEventFilter) ([]*models.AuditEvent, error) {
+	query := r.DB.WithContext(ctx).Order("id DESC").Limit(filter.Limit)
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.TargetID != 0 {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	var events []*models.AuditEvent
+	err := query.Find(&events).Error
+	return events, err
+}
+func (r *auditEventRepositoryGorm) EventsAfter(ctx context.Context, afterID uint, limit int) ([]*models.AuditEvent, error) {
+	var events []*models.AuditEvent
+	err := r.DB.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"time"
+)
+
+type IdentityRepository interface {
+	GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error)
+	// CreateUserWithIdentity creates a user and its first identity together.
+	CreateUserWithIdentity(ctx context.Context, user *models.Users, identity *models.Identity) error
+	TouchIdentity(ctx context.Context, id uint, at time.Time) error
+	// HasIdentity reports whether the user is linked to any external account.
+	HasIdentity(ctx context.Context, userID uint) (bool, error)
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type identityRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewIdentityRepositoryGorm creates a new GORM implementation of IdentityRepository
+func NewIdentityRepositoryGorm(db *gorm.DB) IdentityRepository {
+	return &identityRepositoryGorm{DB: db}
+}
+
+func (r *identityRepositoryGorm) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	err := r.DB.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	return &identity, err
+}
+func (r *identityRepositoryGorm) CreateUserWithIdentity(ctx context.Context, user *models.Users, identity *models.Identity) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Omit("User").Create(identity).Error
+	})
+}
+func (r *identityRepositoryGorm) TouchIdentity(ctx context.Context, id uint, at time.Time) error {
+	return r.DB.WithContext(ctx).Model(&models.Identity{}).Where("id = ?", id).Update("last_login_at", at).Error
+}
+func (r *identityRepositoryGorm) HasIdentity(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	err := r.DB.WithContext(ctx).Model(&models.Identity{}).Where("user_id = ?", userID).Count(&count).Error
+	return count > 0, err
+}
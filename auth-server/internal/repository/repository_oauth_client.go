@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+)
+
+type OAuthClientRepository interface {
+	GetAllClients(ctx context.Context) ([]*models.OAuthClient, error)
+	GetClientByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error)
+	CreateClient(ctx context.Context, client *models.OAuthClient) error
+	DeleteClient(ctx context.Context, id uint) error
+}
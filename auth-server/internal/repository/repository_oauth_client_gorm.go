@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"gorm.io/gorm"
+)
+
+type oauthClientRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewOAuthClientRepositoryGorm creates a new GORM implementation of OAuthClientRepository
+func NewOAuthClientRepositoryGorm(db *gorm.DB) OAuthClientRepository {
+	return &oauthClientRepositoryGorm{DB: db}
+}
+
+func (r *oauthClientRepositoryGorm) GetAllClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	var clients []*models.OAuthClient
+	err := r.DB.WithContext(ctx).Find(&clients).Error
+	return clients, err
+}
+func (r *oauthClientRepositoryGorm) GetClientByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.DB.WithContext(ctx).Where("client_id = ?", clientID).First(&client).Error
+	return &client, err
+}
+func (r *oauthClientRepositoryGorm) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	return r.DB.WithContext(ctx).Create(client).Error
+}
+func (r *oauthClientRepositoryGorm) DeleteClient(ctx context.Context, id uint) error {
+	return r.DB.WithContext(ctx).Delete(&models.OAuthClient{}, id).Error
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+)
+
+type PasswordHistoryRepository interface {
+	GetRecent(ctx context.Context, userID uint, limit int) ([]*models.PasswordHistory, error)
+	Add(ctx context.Context, entry *models.PasswordHistory, keep int) error
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type passwordHistoryRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewPasswordHistoryRepositoryGorm creates a new GORM implementation of PasswordHistoryRepository
+func NewPasswordHistoryRepositoryGorm(db *gorm.DB) PasswordHistoryRepository {
+	return &passwordHistoryRepositoryGorm{DB: db}
+}
+
+func (r *passwordHistoryRepositoryGorm) GetRecent(ctx context.Context, userID uint, limit int) ([]*models.PasswordHistory, error) {
+	var entries []*models.PasswordHistory
+	err := r.DB.WithContext(ctx).Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// Add records a password and prunes the user's history to the newest keep
+// entries.
+func (r *passwordHistoryRepositoryGorm) Add(ctx context.Context, entry *models.PasswordHistory, keep int) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		newest := tx.Model(&models.PasswordHistory{}).Select("id").
+			Where("user_id = ?", entry.UserID).Order("created_at DESC, id DESC").Limit(keep)
+		return tx.Where("user_id = ? AND id NOT IN (?)", entry.UserID, newest).
+			Delete(&models.PasswordHistory{}).Error
+	})
+}
@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+)
+
+type RecoveryCodeRepository interface {
+	ReplaceCodes(ctx context.Context, userID uint, codes []*models.RecoveryCode) error
+	UseCode(ctx context.Context, userID uint, hashedCode string) (bool, error)
+	DeleteCodes(ctx context.Context, userID uint) error
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type recoveryCodeRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewRecoveryCodeRepositoryGorm creates a new GORM implementation of RecoveryCodeRepository
+func NewRecoveryCodeRepositoryGorm(db *gorm.DB) RecoveryCodeRepository {
+	return &recoveryCodeRepositoryGorm{DB: db}
+}
+
+func (r *recoveryCodeRepositoryGorm) ReplaceCodes(ctx context.Context, userID uint, codes []*models.RecoveryCode) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(codes).Error
+	})
+}
+
+// UseCode consumes the user's code with the given hash, returning false if
+// there is no such code or it was already used.
+func (r *recoveryCodeRepositoryGorm) UseCode(ctx context.Context, userID uint, hashedCode string) (bool, error) {
+	res := r.DB.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND hashed_code = ? AND used_at IS NULL", userID, hashedCode).
+		Update("used_at", time.Now())
+	return res.RowsAffected == 1, res.Error
+}
+func (r *recoveryCodeRepositoryGorm) DeleteCodes(ctx context.Context, userID uint) error {
+	return r.DB.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+)
+
+type RoleRepository interface {
+	GetAllRoles(ctx context.Context) ([]*models.Roles, error)
+	GetRoleByID(ctx context.Context, id uint) (*models.Roles, error)
+	GetRolesByNames(ctx context.Context, names []string) ([]*models.Roles, error)
+	CreateRole(ctx context.Context, role *models.Roles) error
+	UpdateRole(ctx context.Context, role *models.Roles, permissions []*models.Permissions) error
+	DeleteRole(ctx context.Context, role *models.Roles) error
+	GetAllPermissions(ctx context.Context) ([]*models.Permissions, error)
+	GetPermissionByID(ctx context.Context, id uint) (*models.Permissions, error)
+	GetPermissionsByNames(ctx context.Context, names []string) ([]*models.Permissions, error)
+	CreatePermission(ctx context.Context, permission *models.Permissions) error
+	DeletePermission(ctx context.Context, permission *models.Permissions) error
+	GetRolesWithPermission(ctx context.Context, permissionID uint) ([]*models.Roles, error)
+	GetUserRoles(ctx context.Context, userID uint) ([]*models.Roles, error)
+	SetUserRoles(ctx context.Context, userID uint, roles []*models.Roles) error
+	GetUserPermissions(ctx context.Context, userID uint) ([]string, error)
+	GetUserIDsWithRole(ctx context.Context, role *models.Roles) ([]uint, error)
+	CountUsersWithPrimaryRole(ctx context.Context, name string) (int64, error)
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type roleRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewRoleRepositoryGorm creates a new GORM implementation of RoleRepository
+func NewRoleRepositoryGorm(db *gorm.DB) RoleRepository {
+	return &roleRepositoryGorm{DB: db}
+}
+
+func (r *roleRepositoryGorm) GetAllRoles(ctx context.Context) ([]*models.Roles, error) {
+	var roles []*models.Roles
+	err := r.DB.WithContext(ctx).Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+func (r *roleRepositoryGorm) GetRoleByID(ctx context.Context, id uint) (*models.Roles, error) {
+	var role models.Roles
+	err := r.DB.WithContext(ctx).Preload("Permissions").First(&role, id).Error
+	return &role, err
+}
+func (r *roleRepositoryGorm) GetRolesByNames(ctx context.Context, names []string) ([]*models.Roles, error) {
+	var roles []*models.Roles
+	err := r.DB.WithContext(ctx).Where("name IN ?", names).Find(&roles).Error
+	return roles, err
+}
+func (r *roleRepositoryGorm) CreateRole(ctx context.Context, role *models.Roles) error {
+	return r.DB.WithContext(ctx).Create(role).Error
+}
+func (r *roleRepositoryGorm) UpdateRole(ctx context.Context, role *models.Roles, permissions []*models.Permissions) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Updates(map[string]interface{}{"description": role.Description, "require_passkey": role.RequirePasskey}).Error; err != nil {
+			return err
+		}
+		return tx.Model(role).Association("Permissions").Replace(permissions)
+	})
+}
+func (r *roleRepositoryGorm) DeleteRole(ctx context.Context, role *models.Roles) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Table("user_roles").Where("role_id = ?", role.ID).Delete(nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+}
+func (r *roleRepositoryGorm) GetAllPermissions(ctx context.Context) ([]*models.Permissions, error) {
+	var permissions []*models.Permissions
+	err := r.DB.WithContext(ctx).Order("name").Find(&permissions).Error
+	return permissions, err
+}
+func (r *roleRepositoryGorm) GetPermissionByID(ctx context.Context, id uint) (*models.Permissions, error) {
+	var permission models.Permissions
+	err := r.DB.WithContext(ctx).First(&permission, id).Error
+	return &permission, err
+}
+func (r *roleRepositoryGorm) GetPermissionsByNames(ctx context.Context, names []string) ([]*models.Permissions, error) {
+	var permissions []*models.Permissions
+	err := r.DB.WithContext(ctx).Where("name IN ?", names).Find(&permissions).Error
+	return permissions, err
+}
+func (r *roleRepositoryGorm) CreatePermission(ctx context.Context, permission *models.Permissions) error {
+	return r.DB.WithContext(ctx).Create(permission).Error
+}
+func (r *roleRepositoryGorm) DeletePermission(ctx context.Context, permission *models.Permissions) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("role_permissions").Where("permission_id = ?", permission.ID).Delete(nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(permission).Error
+	})
+}
+func (r *roleRepositoryGorm) GetRolesWithPermission(ctx context.Context, permissionID uint) ([]*models.Roles, error) {
+	var roles []*models.Roles
+	err := r.DB.WithContext(ctx).
+		Where("id IN (?)", r.DB.Table("role_permissions").Select("role_id").Where("permission_id = ?", permissionID)).
+		Find(&roles).Error
+	return roles, err
+}
+func (r *roleRepositoryGorm) GetUserRoles(ctx context.Context, userID uint) ([]*models.Roles, error) {
+	var roles []*models.Roles
+	err := r.DB.WithContext(ctx).Model(&models.Users{ID: userID}).Association("Roles").Find(&roles)
+	return roles, err
+}
+func (r *roleRepositoryGorm) SetUserRoles(ctx context.Context, userID uint, roles []*models.Roles) error {
+	return r.DB.WithContext(ctx).Model(&models.Users{ID: userID}).Association("Roles").Replace(roles)
+}
+
+// GetUserPermissions resolves the permissions granted by the user's primary
+// role and by every role assigned through user_roles.
+func (r *roleRepositoryGorm) GetUserPermissions(ctx context.Context, userID uint) ([]string, error) {
+	var names []string
+	err := r.DB.WithContext(ctx).Raw(`
+		SELECT DISTINCT p.name FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		JOIN roles r ON r.id = rp.role_id
+		WHERE r.name = (SELECT role FROM users WHERE id = ?)
+		   OR r.id IN (SELECT role_id FROM user_roles WHERE user_id = ?)
+		ORDER BY p.name`, userID, userID).Scan(&names).Error
+	return names, err
+}
+func (r *roleRepositoryGorm) GetUserIDsWithRole(ctx context.Context, role *models.Roles) ([]uint, error) {
+	var ids []uint
+	err := r.DB.WithContext(ctx).Model(&models.Users{}).
+		Where("role = ? OR id IN (?)", role.Name, r.DB.Table("user_roles").Select("user_id").Where("role_id = ?", role.ID)).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+func (r *roleRepositoryGorm) CountUsersWithPrimaryRole(ctx context.Context, name string) (int64, error) {
+	var count int64
+	err := r.DB.WithContext(ctx).Model(&models.Users{}).Where("role = ?", name).Count(&count).Error
+	return count, err
+}
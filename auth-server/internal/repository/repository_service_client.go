@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+)
+
+type ServiceClientRepository interface {
+	GetAllClients(ctx context.Context) ([]*models.ServiceClient, error)
+	GetClientByClientID(ctx context.Context, clientID string) (*models.ServiceClient, error)
+	CreateClient(ctx context.Context, client *models.ServiceClient) error
+	DeleteClient(ctx context.Context, id uint) error
+}
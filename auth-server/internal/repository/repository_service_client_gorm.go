@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"gorm.io/gorm"
+)
+
+type serviceClientRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewServiceClientRepositoryGorm creates a new GORM implementation of ServiceClientRepository
+func NewServiceClientRepositoryGorm(db *gorm.DB) ServiceClientRepository {
+	return &serviceClientRepositoryGorm{DB: db}
+}
+
+func (r *serviceClientRepositoryGorm) GetAllClients(ctx context.Context) ([]*models.ServiceClient, error) {
+	var clients []*models.ServiceClient
+	err := r.DB.WithContext(ctx).Find(&clients).Error
+	return clients, err
+}
+func (r *serviceClientRepositoryGorm) GetClientByClientID(ctx context.Context, clientID string) (*models.ServiceClient, error) {
+	var client models.ServiceClient
+	err := r.DB.WithContext(ctx).Where("client_id = ?", clientID).First(&client).Error
+	return &client, err
+}
+func (r *serviceClientRepositoryGorm) CreateClient(ctx context.Context, client *models.ServiceClient) error {
+	return r.DB.WithContext(ctx).Create(client).Error
+}
+func (r *serviceClientRepositoryGorm) DeleteClient(ctx context.Context, id uint) error {
+	return r.DB.WithContext(ctx).Delete(&models.ServiceClient{}, id).Error
+}
@@ -3,13 +3,26 @@ package repository
 import (
 	"auth-server/internal/models"
 	"context"
+	"errors"
+)
+
+// ErrUserNameTaken and ErrEmailTaken are returned by CreateUser and
+// UpdateUser when another user already has the user name, compared ignoring
+// case, or the email.
+var (
+	ErrUserNameTaken = errors.New("user name is already taken")
+	ErrEmailTaken    = errors.New("email is already in use")
 )
 
 type UserRepository interface {
 	GetAllUsers(ctx context.Context) ([]*models.Users, error)
 	GetUserByID(ctx context.Context, id uint) (*models.Users, error)
+	GetUserByUserName(ctx context.Context, userName string) (*models.Users, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.Users, error)
 	CreateUser(ctx context.Context, user *models.Users) error
 	UpdateUser(ctx context.Context, id uint, updates map[string]interface{}) error
 	DeleteUser(ctx context.Context, id uint) error
 	CheckRole(ctx context.Context, id uint) (string, error)
+	ReplacePasswordHash(ctx context.Context, id uint, oldHash, newHash string) error
+	BumpTokenVersion(ctx context.Context, id uint) (int, error)
 }
@@ -3,9 +3,16 @@ package repository
 import (
 	"auth-server/internal/models"
 	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
+// pgUniqueViolation is the PostgreSQL error code of unique_violation.
+const pgUniqueViolation = "23505"
+
 type userRepositoryGorm struct {
 	DB *gorm.DB
 }
@@ -25,17 +32,79 @@ func (r *userRepositoryGorm) GetUserByID(ctx context.Context, id uint) (*models.
 	err := r.DB.WithContext(ctx).First(&user, id).Error
 	return &user, err
 }
+
+// GetUserByUserName matches case-insensitively, using the lower(user_name)
+// index created in models.Migrate.
+func (r *userRepositoryGorm) GetUserByUserName(ctx context.Context, userName string) (*models.Users, error) {
+	var user models.Users
+	err := r.DB.WithContext(ctx).Where("LOWER(user_name) = LOWER(?)", userName).First(&user).Error
+	return &user, err
+}
+func (r *userRepositoryGorm) GetUserByEmail(ctx context.Context, email string) (*models.Users, error) {
+	var user models.Users
+	err := r.DB.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	return &user, err
+}
 func (r *userRepositoryGorm) CreateUser(ctx context.Context, user *models.Users) error {
-	return r.DB.WithContext(ctx).Create(user).Error
+	return userConflict(r.DB.WithContext(ctx).Create(user).Error)
 }
 func (r *userRepositoryGorm) UpdateUser(ctx context.Context, id uint, updates map[string]interface{}) error {
-	return r.DB.WithContext(ctx).Model(&models.Users{}).Where("id = ?", id).Updates(updates).Error
+	return userConflict(r.DB.WithContext(ctx).Model(&models.Users{}).Where("id = ?", id).Updates(updates).Error)
 }
+
+// DeleteUser deletes the user together with their role assignments and
+// credentials, which have foreign keys to the user.
 func (r *userRepositoryGorm) DeleteUser(ctx context.Context, id uint) error {
-	return r.DB.WithContext(ctx).Delete(&models.Users{}, id).Error
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		user := &models.Users{ID: id}
+		if err := tx.Model(user).Association("Roles").Clear(); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.APIKey{}, &models.WebAuthnCredential{}, &models.RecoveryCode{}, &models.PasswordHistory{}, &models.Identity{}} {
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(user).Error
+	})
 }
 func (r *userRepositoryGorm) CheckRole(ctx context.Context, id uint) (string, error) {
 	var user models.Users
 	err := r.DB.WithContext(ctx).Select("role").Where("id = ?", id).First(&user).Error
 	return user.Role, err
 }
+
+// ReplacePasswordHash swaps in a new hash of the same password. It is a no-op
+// if the password was changed in the meantime.
+func (r *userRepositoryGorm) ReplacePasswordHash(ctx context.Context, id uint, oldHash, newHash string) error {
+	return r.DB.WithContext(ctx).Model(&models.Users{}).
+		Where("id = ? AND hashed_password = ?", id, oldHash).
+		Update("hashed_password", newHash).Error
+}
+func (r *userRepositoryGorm) BumpTokenVersion(ctx context.Context, id uint) (int, error) {
+	var user models.Users
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Users{}).Where("id = ?", id).
+			Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Select("token_version").Where("id = ?", id).First(&user).Error
+	})
+	return user.TokenVersion, err
+}
+
+// userConflict turns unique violations on the users table into
+// ErrUserNameTaken or ErrEmailTaken.
+func userConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != pgUniqueViolation {
+		return err
+	}
+	switch {
+	case strings.Contains(pgErr.ConstraintName, "user_name"):
+		return ErrUserNameTaken
+	case strings.Contains(pgErr.ConstraintName, "email"):
+		return ErrEmailTaken
+	}
+	return err
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+	"errors"
+)
+
+// ErrLastCredential is returned by DeleteCredential when keepLast is set and
+// the passkey is the user's only one.
+var ErrLastCredential = errors.New("cannot delete the last passkey")
+
+type WebAuthnCredentialRepository interface {
+	GetCredentialsByUserID(ctx context.Context, userID uint) ([]*models.WebAuthnCredential, error)
+	CountCredentials(ctx context.Context, userID uint) (int64, error)
+	CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	// UpdateCredentialUse stores the counter, flags, clone warning and
+	// last-used time after a login.
+	UpdateCredentialUse(ctx context.Context, credential *models.WebAuthnCredential) error
+	// DeleteCredential removes one of the user's passkeys, returning false if
+	// they have none with that ID. With keepLast it refuses to remove the
+	// only one.
+	DeleteCredential(ctx context.Context, userID, id uint, keepLast bool) (bool, error)
+}
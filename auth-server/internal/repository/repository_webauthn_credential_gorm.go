@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"auth-server/internal/models"
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type webAuthnCredentialRepositoryGorm struct {
+	DB *gorm.DB
+}
+
+// NewWebAuthnCredentialRepositoryGorm creates a new GORM implementation of WebAuthnCredentialRepository
+func NewWebAuthnCredentialRepositoryGorm(db *gorm.DB) WebAuthnCredentialRepository {
+	return &webAuthnCredentialRepositoryGorm{DB: db}
+}
+
+func (r *webAuthnCredentialRepositoryGorm) GetCredentialsByUserID(ctx context.Context, userID uint) ([]*models.WebAuthnCredential, error) {
+	var credentials []*models.WebAuthnCredential
+	err := r.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	return credentials, err
+}
+func (r *webAuthnCredentialRepositoryGorm) CountCredentials(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.DB.WithContext(ctx).Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+func (r *webAuthnCredentialRepositoryGorm) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	return r.DB.WithContext(ctx).Create(credential).Error
+}
+func (r *webAuthnCredentialRepositoryGorm) UpdateCredentialUse(ctx context.Context, credential *models.WebAuthnCredential) error {
+	return r.DB.WithContext(ctx).Model(credential).Updates(map[string]interface{}{
+		"sign_count":    credential.SignCount,
+		"flags":         credential.Flags,
+		"clone_warning": credential.CloneWarning,
+		"last_used_at":  credential.LastUsedAt,
+	}).Error
+}
+
+// DeleteCredential locks the user's passkeys while counting them, so two
+// concurrent deletes cannot remove the last two.
+func (r *webAuthnCredentialRepositoryGorm) DeleteCredential(ctx context.Context, userID, id uint, keepLast bool) (bool, error) {
+	deleted := false
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Model(&models.WebAuthnCredential{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if keepLast && len(ids) == 1 && ids[0] == id {
+			return ErrLastCredential
+		}
+		res := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+		deleted = res.RowsAffected == 1
+		return res.Error
+	})
+	return deleted, err
+}
@@ -3,20 +3,132 @@ package routes
 import (
 	"auth-server/internal/handlers"
 	"auth-server/internal/middleware"
+	"auth-server/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine, authHandler *handlers.AuthHandler, userHandler *handlers.UserHandler) {
+func SetupRoutes(r *gin.Engine, authHandler *handlers.AuthHandler, userHandler *handlers.UserHandler, oidcHandler *handlers.OIDCHandler, twoFactorHandler *handlers.TwoFactorHandler, sessionHandler *handlers.SessionHandler, roleHandler *handlers.RoleHandler, passwordHandler *handlers.PasswordHandler, apiKeyHandler *handlers.APIKeyHandler, serviceClientHandler *handlers.ServiceClientHandler, introspectionHandler *handlers.IntrospectionHandler, federationHandler *handlers.FederationHandler, webAuthnHandler *handlers.WebAuthnHandler, magicLinkHandler *handlers.MagicLinkHandler, auditHandler *handlers.AuditHandler) {
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
+	r.GET("/.well-known/openid-configuration", oidcHandler.Discovery)
+	r.GET("/authorize", oidcHandler.AuthorizeForm)
+	r.POST("/authorize", oidcHandler.Authorize)
+	r.POST("/token", oidcHandler.Token)
+	r.POST("/oauth/token", oidcHandler.Token)
+	r.POST("/oauth/introspect", introspectionHandler.Introspect)
+	r.POST("/oauth/revoke", introspectionHandler.Revoke)
+	r.POST("/oauth/device/code", oidcHandler.DeviceAuthorization)
+	r.GET("/device", oidcHandler.DeviceForm)
+	r.POST("/device", oidcHandler.DeviceVerify)
+	r.GET("/userinfo", middleware.JWTAuthMiddleware(), oidcHandler.UserInfo)
+	r.POST("/userinfo", middleware.JWTAuthMiddleware(), oidcHandler.UserInfo)
+
 	r.POST("/api/login", authHandler.Login)
-	r.POST("/api/logout", middleware.JWTAuthMiddleware(), authHandler.Logout)
+	r.POST("/api/login/2fa", authHandler.LoginTwoFactor)
+	r.POST("/api/login/webauthn/begin", webAuthnHandler.BeginLogin)
+	r.POST("/api/login/webauthn/finish", webAuthnHandler.FinishLogin)
+	r.POST("/api/login/magic", magicLinkHandler.Request)
+	r.GET("/api/login/magic/verify", magicLinkHandler.Verify)
+	r.POST("/api/refresh", authHandler.Refresh)
+	r.POST("/api/logout", middleware.JWTAuthMiddleware(), middleware.DenyAPIKey(), authHandler.Logout)
+	r.GET("/api/auth/verify", middleware.JWTAuthMiddleware(), authHandler.Verify)
+	r.POST("/api/password/forgot", passwordHandler.Forgot)
+	r.POST("/api/password/reset", passwordHandler.Reset)
+	r.GET("/api/federation/providers", federationHandler.GetProviders)
+	r.GET("/api/federation/:provider/login", federationHandler.Login)
+	r.GET("/api/federation/:provider/callback", federationHandler.Callback)
+	meRoutes := r.Group("/api/me")
+	meRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		meRoutes.GET("", userHandler.GetMe)
+		meRoutes.PATCH("", middleware.Audit(services.AuditUserUpdate), middleware.DenyImpersonation(), middleware.DenyAPIKey(), userHandler.UpdateMe)
+		meRoutes.POST("/password", middleware.Audit(services.AuditPasswordChange), middleware.DenyImpersonation(), middleware.DenyAPIKey(), userHandler.ChangeMyPassword)
+	}
 	userRoutes := r.Group("/api/users")
 	userRoutes.Use(middleware.JWTAuthMiddleware())
 	{
-		userRoutes.GET("/", userHandler.GetAllUsers)
-		userRoutes.POST("/", userHandler.CreateUser)
-		userRoutes.PUT("/:id", userHandler.UpdateUser)
-		userRoutes.DELETE("/:id", userHandler.DeleteUser)
-		userRoutes.GET("/:id", userHandler.GetUserByID)
+		userRoutes.GET("/", middleware.AuthorizeUser(services.UserList), userHandler.GetAllUsers)
+		userRoutes.POST("/", middleware.Audit(services.AuditUserCreate), middleware.DenyImpersonation(), middleware.AuthorizeUser(services.UserCreate), userHandler.CreateUser)
+		userRoutes.PUT("/:id", middleware.Audit(services.AuditUserUpdate), middleware.DenyImpersonation(), middleware.DenyAPIKey(), middleware.AuthorizeUser(services.UserUpdate), userHandler.UpdateUser)
+		userRoutes.DELETE("/:id", middleware.Audit(services.AuditUserDelete), middleware.DenyImpersonation(), middleware.AuthorizeUser(services.UserDelete), userHandler.DeleteUser)
+		userRoutes.GET("/:id", middleware.AuthorizeUser(services.UserRead), userHandler.GetUserByID)
+		userRoutes.DELETE("/:id/2fa", middleware.Audit(services.AuditUserResetTwoFactor), middleware.DenyImpersonation(), middleware.AuthorizeUser(services.UserResetTwoFactor), twoFactorHandler.Reset)
+		userRoutes.POST("/:id/unlock", middleware.Audit(services.AuditUserUnlock), middleware.DenyImpersonation(), middleware.AuthorizeUser(services.UserUnlock), userHandler.UnlockUser)
+		userRoutes.DELETE("/:id/sessions", middleware.Audit(services.AuditUserRevokeSessions), middleware.DenyImpersonation(), middleware.AuthorizeUser(services.UserRevokeSessions), sessionHandler.RevokeUserSessions)
+		userRoutes.PUT("/:id/roles", middleware.Audit(services.AuditUserSetRoles), middleware.DenyImpersonation(), middleware.RequirePermission("roles:write"), roleHandler.SetUserRoles)
+	}
+	adminRoutes := r.Group("/api/admin")
+	adminRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		adminRoutes.POST("/impersonate/end", middleware.DenyAPIKey(), authHandler.EndImpersonation)
+		adminRoutes.POST("/impersonate/:id", middleware.DenyImpersonation(), middleware.DenyAPIKey(), middleware.RequirePermission("users:impersonate"), authHandler.Impersonate)
+	}
+	// Called by the other services with client_credentials tokens.
+	serviceRoutes := r.Group("/api/service")
+	serviceRoutes.Use(middleware.ClientAuthMiddleware())
+	{
+		serviceRoutes.GET("/users/:id", middleware.RequireScope("users:read"), userHandler.GetUserByID)
+	}
+	auditRoutes := r.Group("/api/audit")
+	auditRoutes.Use(middleware.JWTAuthMiddleware(), middleware.RequirePermission("audit:read"))
+	{
+		auditRoutes.GET("/", auditHandler.GetEvents)
+		auditRoutes.GET("/verify", auditHandler.Verify)
+	}
+	sessionRoutes := r.Group("/api/sessions")
+	sessionRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		sessionRoutes.GET("/", sessionHandler.GetMySessions)
+		sessionRoutes.DELETE("/:id", middleware.DenyImpersonation(), middleware.DenyAPIKey(), sessionHandler.RevokeMySession)
+	}
+	apiKeyRoutes := r.Group("/api/api-keys")
+	apiKeyRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		apiKeyRoutes.GET("/", apiKeyHandler.GetMyKeys)
+		apiKeyRoutes.POST("/", middleware.DenyImpersonation(), middleware.DenyAPIKey(), apiKeyHandler.CreateKey)
+		apiKeyRoutes.DELETE("/:id", middleware.DenyImpersonation(), middleware.DenyAPIKey(), apiKeyHandler.RevokeKey)
+	}
+	webAuthnRoutes := r.Group("/api/webauthn")
+	webAuthnRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		webAuthnRoutes.POST("/register/begin", middleware.DenyImpersonation(), middleware.DenyAPIKey(), webAuthnHandler.BeginRegistration)
+		webAuthnRoutes.POST("/register/finish", middleware.DenyImpersonation(), middleware.DenyAPIKey(), webAuthnHandler.FinishRegistration)
+		webAuthnRoutes.GET("/credentials", webAuthnHandler.GetMyPasskeys)
+		webAuthnRoutes.DELETE("/credentials/:id", middleware.DenyImpersonation(), middleware.DenyAPIKey(), webAuthnHandler.DeletePasskey)
+	}
+	twoFactorRoutes := r.Group("/api/2fa")
+	twoFactorRoutes.Use(middleware.JWTAuthMiddleware(), middleware.DenyImpersonation(), middleware.DenyAPIKey())
+	{
+		twoFactorRoutes.POST("/enroll", twoFactorHandler.Enroll)
+		twoFactorRoutes.POST("/confirm", twoFactorHandler.Confirm)
+	}
+	clientRoutes := r.Group("/api/oauth-clients")
+	clientRoutes.Use(middleware.JWTAuthMiddleware(), middleware.DenyImpersonation(), middleware.RequirePermission("clients:write"))
+	{
+		clientRoutes.GET("/", oidcHandler.GetAllClients)
+		clientRoutes.POST("/", oidcHandler.CreateClient)
+		clientRoutes.DELETE("/:id", oidcHandler.DeleteClient)
+	}
+	serviceClientRoutes := r.Group("/api/service-clients")
+	serviceClientRoutes.Use(middleware.JWTAuthMiddleware(), middleware.DenyImpersonation(), middleware.RequirePermission("clients:write"))
+	{
+		serviceClientRoutes.GET("/", serviceClientHandler.GetAllClients)
+		serviceClientRoutes.POST("/", serviceClientHandler.CreateClient)
+		serviceClientRoutes.DELETE("/:id", serviceClientHandler.DeleteClient)
+	}
+	roleRoutes := r.Group("/api/roles")
+	roleRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		roleRoutes.GET("/", middleware.RequirePermission("roles:read"), roleHandler.GetAllRoles)
+		roleRoutes.POST("/", middleware.DenyImpersonation(), middleware.RequirePermission("roles:write"), roleHandler.CreateRole)
+		roleRoutes.PUT("/:id", middleware.DenyImpersonation(), middleware.RequirePermission("roles:write"), roleHandler.UpdateRole)
+		roleRoutes.DELETE("/:id", middleware.DenyImpersonation(), middleware.RequirePermission("roles:write"), roleHandler.DeleteRole)
+	}
+	permissionRoutes := r.Group("/api/permissions")
+	permissionRoutes.Use(middleware.JWTAuthMiddleware())
+	{
+		permissionRoutes.GET("/", middleware.RequirePermission("roles:read"), roleHandler.GetAllPermissions)
+		permissionRoutes.POST("/", middleware.DenyImpersonation(), middleware.RequirePermission("roles:write"), roleHandler.CreatePermission)
+		permissionRoutes.DELETE("/:id", middleware.DenyImpersonation(), middleware.RequirePermission("roles:write"), roleHandler.DeletePermission)
 	}
 }
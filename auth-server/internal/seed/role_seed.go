@@ -0,0 +1,72 @@
+package seed
+
+import (
+	"log"
+
+	"auth-server/internal/models"
+	"gorm.io/gorm"
+)
+
+// SeedRoles creates the built-in permissions and roles. Existing rows are left
+// alone so changes made through the admin API survive restarts.
+func SeedRoles(db *gorm.DB) {
+	permissions := []struct {
+		Name        string
+		Description string
+	}{
+		{models.PermissionAll, "Every permission"},
+		{"users:read", "List and view users"},
+		{"users:write", "Create and update users, unlock accounts, reset 2FA"},
+		{"users:delete", "Delete users"},
+		{"users:password", "Set other users' passwords"},
+		{"users:impersonate", "Act as users with no more permissions than oneself"},
+		{"roles:read", "List roles and permissions"},
+		{"roles:write", "Manage roles, permissions and role assignments"},
+		{"sessions:revoke", "Revoke other users' sessions"},
+		{"clients:write", "Manage registered OAuth clients"},
+		{"audit:read", "View and verify the security audit log"},
+		{"billing:read", "View billing data"},
+		{"billing:write", "Change billing data"},
+		{"content:moderate", "Moderate user content"},
+	}
+	roles := []struct {
+		Name        string
+		Description string
+		Permissions []string
+	}{
+		{"admin", "Full access", []string{models.PermissionAll}},
+		{"user", "Regular user", nil},
+		{"support", "Customer support", []string{"users:read", "users:write", "sessions:revoke"}},
+		{"billing", "Billing team", []string{"users:read", "billing:read", "billing:write"}},
+		{"moderator", "Content moderation", []string{"users:read", "content:moderate"}},
+	}
+
+	byName := map[string]*models.Permissions{}
+	for _, p := range permissions {
+		perm := models.Permissions{Name: p.Name, Description: p.Description}
+		if err := db.Where("name = ?", p.Name).FirstOrCreate(&perm).Error; err != nil {
+			log.Printf("Không thể tạo permission %s: %v", p.Name, err)
+			continue
+		}
+		byName[p.Name] = &perm
+	}
+
+	for _, r := range roles {
+		var existing models.Roles
+		if err := db.Where("name = ?", r.Name).First(&existing).Error; err == nil {
+			continue
+		}
+
+		role := models.Roles{Name: r.Name, Description: r.Description}
+		for _, name := range r.Permissions {
+			if perm, ok := byName[name]; ok {
+				role.Permissions = append(role.Permissions, perm)
+			}
+		}
+		if err := db.Create(&role).Error; err != nil {
+			log.Printf("Không thể tạo role %s: %v", r.Name, err)
+		} else {
+			log.Printf("Đã thêm role %s thành công", r.Name)
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"log"
 
 	"auth-server/internal/models"
-	"golang.org/x/crypto/bcrypt"
+	"auth-server/internal/services"
 	"gorm.io/gorm"
 )
 
@@ -27,7 +27,7 @@ func SeedUsers(db *gorm.DB) {
 			continue
 		}
 
-		hashed, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		hashed, err := services.HashPassword(u.Password)
 		if err != nil {
 			log.Printf("Không thể hash password cho %s: %v", u.UserName, err)
 			continue
@@ -35,7 +35,7 @@ func SeedUsers(db *gorm.DB) {
 
 		user := models.Users{
 			UserName:       u.UserName,
-			HashedPassword: string(hashed),
+			HashedPassword: hashed,
 			Role:           u.Role,
 		}
 
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyPrefix = "ak_"
+	// apiKeyTouchResolution limits how often a key's last-used time is written.
+	apiKeyTouchResolution = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey   = errors.New("invalid or expired api key")
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrScopeNotGranted = errors.New("scope not granted to user")
+)
+
+// APIKeyPrincipal is the caller authenticated by an API key. Permissions are
+// the key's scopes that the owner still holds. There is deliberately no role:
+// the key only grants its scopes, not whatever the owner's role implies.
+type APIKeyPrincipal struct {
+	KeyID       uint
+	UserID      uint
+	Permissions []string
+}
+
+type APIKeyService struct {
+	repo     repository.APIKeyRepository
+	userRepo repository.UserRepository
+	roles    *RoleService
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, userRepo repository.UserRepository, roles *RoleService) *APIKeyService {
+	return &APIKeyService{repo: repo, userRepo: userRepo, roles: roles}
+}
+
+// Create issues a key for the user. Every scope must be a permission the user
+// holds. The plain key is returned only here.
+func (s *APIKeyService) Create(ctx context.Context, userID uint, req *dto.CreateAPIKeyRequest) (*models.APIKey, string, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", errors.New("expires_at must be in the future")
+	}
+	granted, err := s.roles.PermissionsForUser(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, scope := range req.Scopes {
+		if !HasPermission(granted, scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrScopeNotGranted, scope)
+		}
+	}
+
+	secret, err := generateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	plain := apiKeyPrefix + secret
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    plain[:len(apiKeyPrefix)+6],
+		HashedKey: hashToken(plain),
+		Scopes:    strings.Join(req.Scopes, " "),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.repo.CreateKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, plain, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, userID uint) ([]*models.APIKey, error) {
+	return s.repo.GetKeysByUserID(ctx, userID)
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id uint) error {
+	deleted, err := s.repo.DeleteKey(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves a plain key to its owner. Scopes are intersected with
+// the owner's current permissions, so losing a permission also takes it away
+// from their keys.
+func (s *APIKeyService) Authenticate(ctx context.Context, plain string) (*APIKeyPrincipal, error) {
+	if !strings.HasPrefix(plain, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := s.repo.GetKeyByHash(ctx, hashToken(plain))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key.Expired(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, key.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	granted, err := s.roles.PermissionsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := []string{}
+	for _, scope := range key.ScopeList() {
+		if HasPermission(granted, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchResolution {
+		if err := s.repo.TouchKey(ctx, key.ID, now); err != nil {
+			log.Printf("failed to record use of api key %d: %v", key.ID, err)
+		}
+	}
+	return &APIKeyPrincipal{KeyID: key.ID, UserID: user.ID, Permissions: permissions}, nil
+}
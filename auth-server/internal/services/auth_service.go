@@ -3,69 +3,546 @@ package services
 import (
 	"auth-server/internal/config"
 	"auth-server/internal/dto"
+	"auth-server/internal/keys"
 	"auth-server/internal/models"
 	"auth-server/internal/repository"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaChallengeTTL      = 5 * time.Minute
+	maxMFAChallengeTries = 5
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrInvalidChallenge    = errors.New("invalid or expired challenge token")
+	ErrInvalidCredentials  = errors.New("invalid username or password")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrSessionRevoked      = errors.New("token expired or logged out")
+	ErrTokenOutdated       = errors.New("token was invalidated by an account change, log in again")
 )
 
 type AuthService struct {
-	userRepo repository.UserRepository
-	Redis    *redis.Client
+	userRepo  repository.UserRepository
+	sessions  *SessionService
+	versions  *TokenVersionStore
+	roles     *RoleService
+	twoFactor *TwoFactorService
+	limiter   *LoginLimiter
+	denylist  *TokenDenylist
+	passkeys  repository.WebAuthnCredentialRepository
+	audit     *AuditService
+	// authenticators by Name; config.Authentication.Backends picks the ones
+	// used and their order.
+	authenticators map[string]Authenticator
+	Redis          *redis.Client
+	Keys           *keys.KeySet
+}
+
+// AccessClaims are the claims of the access tokens issued by Login and
+// Refresh. SessionID ties the token to the session it was issued in and
+// TokenVersion to the user's token version at the time. Permissions are the
+// user's effective permissions when the token was issued; changing them bumps
+// the token version, so a valid token never carries stale permissions. Actor
+// is only set on impersonation tokens.
+type AccessClaims struct {
+	UserID       uint        `json:"user_id"`
+	Role         string      `json:"role"`
+	Permissions  []string    `json:"perms"`
+	SessionID    string      `json:"sid"`
+	TokenVersion int         `json:"ver"`
+	Actor        *ActorClaim `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ActorClaim is the "act" claim of RFC 8693: the admin acting as the token's
+// subject. TokenVersion is the admin's, so the token dies with their rights.
+type ActorClaim struct {
+	Subject      string `json:"sub"`
+	UserID       uint   `json:"user_id"`
+	UserName     string `json:"username"`
+	TokenVersion int    `json:"ver"`
+}
+
+// ActorID returns the ID of the impersonating admin, or 0.
+func (c *AccessClaims) ActorID() uint {
+	if c.Actor == nil {
+		return 0
+	}
+	return c.Actor.UserID
 }
 
-func NewAuthService(userRepo repository.UserRepository, Redis *redis.Client) *AuthService {
-	return &AuthService{userRepo: userRepo, Redis: Redis}
+// refreshTokenData is stored in Redis under refresh:<sha256(token)>.
+type refreshTokenData struct {
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"session_id"`
+	// ClientID is the OAuth client the token was issued to; empty for
+	// first-party logins, whose tokens are refreshed at /api/refresh.
+	ClientID string `json:"client_id,omitempty"`
 }
 
-func (s *AuthService) Login(ctx context.Context, req *dto.LoginRequest) (dto.LoginResponse, error) {
-	users, err := s.userRepo.GetAllUsers(ctx)
+func NewAuthService(userRepo repository.UserRepository, sessions *SessionService, versions *TokenVersionStore, roles *RoleService, twoFactor *TwoFactorService, limiter *LoginLimiter, denylist *TokenDenylist, passkeys repository.WebAuthnCredentialRepository, audit *AuditService, authenticators []Authenticator, Redis *redis.Client, keySet *keys.KeySet) *AuthService {
+	byName := map[string]Authenticator{}
+	for _, a := range authenticators {
+		byName[a.Name()] = a
+	}
+	return &AuthService{userRepo: userRepo, sessions: sessions, versions: versions, roles: roles, twoFactor: twoFactor, limiter: limiter, denylist: denylist, passkeys: passkeys, audit: audit, authenticators: byName, Redis: Redis, Keys: keySet}
+}
+
+// Login checks the password. Users with 2FA enabled get a short-lived
+// challenge token instead of a session, to be redeemed with LoginTwoFactor.
+func (s *AuthService) Login(ctx context.Context, req *dto.LoginRequest, client dto.ClientInfo) (dto.LoginResponse, error) {
+	user, err := s.authenticate(ctx, req.UserName, req.Password, client)
 	if err != nil {
 		return dto.LoginResponse{}, err
 	}
+	return s.completeLogin(ctx, user, client)
+}
+
+// completeLogin follows a successful first factor: it starts a session, or
+// issues a 2FA challenge if the user has 2FA enabled.
+func (s *AuthService) completeLogin(ctx context.Context, user *models.Users, client dto.ClientInfo) (dto.LoginResponse, error) {
+	if !user.TOTPEnabled {
+		return s.startSession(ctx, user, client)
+	}
 
-	var user *models.Users
-	for _, u := range users {
-		if u.UserName == req.UserName {
-			user = u
-			break
+	challenge, err := generateRandomToken(32)
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if err := s.Redis.Set(ctx, challengeKey(hashToken(challenge)), user.ID, mfaChallengeTTL).Err(); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	return dto.LoginResponse{MFARequired: true, ChallengeToken: challenge}, nil
+}
+
+// LoginTwoFactor completes a login started by Login with a TOTP or recovery
+// code. A challenge is dropped after too many wrong codes.
+func (s *AuthService) LoginTwoFactor(ctx context.Context, req *dto.TwoFactorLoginRequest, client dto.ClientInfo) (dto.LoginResponse, error) {
+	hash := hashToken(req.ChallengeToken)
+	userID, err := s.Redis.Get(ctx, challengeKey(hash)).Uint64()
+	if err == redis.Nil {
+		return dto.LoginResponse{}, ErrInvalidChallenge
+	}
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, uint(userID))
+	if err != nil {
+		return dto.LoginResponse{}, ErrInvalidChallenge
+	}
+	if err := s.twoFactor.Verify(ctx, user, req.Code); err != nil {
+		s.audit.Record(ctx, AuditEntry{ActorID: user.ID, ActorName: user.UserName, Action: AuditLoginTwoFactor, Client: client, Diff: map[string]string{"reason": err.Error()}})
+		attempts, _ := s.Redis.Incr(ctx, "mfa_attempts:"+hash).Result()
+		s.Redis.Expire(ctx, "mfa_attempts:"+hash, mfaChallengeTTL)
+		if attempts >= maxMFAChallengeTries {
+			s.Redis.Del(ctx, challengeKey(hash))
 		}
+		return dto.LoginResponse{}, err
 	}
 
-	if user == nil {
-		return dto.LoginResponse{}, errors.New("invalid username or password")
+	// Deleting the challenge is what makes it single-use.
+	deleted, err := s.Redis.Del(ctx, challengeKey(hash)).Result()
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if deleted == 0 {
+		return dto.LoginResponse{}, ErrInvalidChallenge
+	}
+	return s.startSession(ctx, user, client)
+}
+
+// authenticate checks a username/password pair and records failures in the
+// audit log; successful logins are recorded when the session starts.
+func (s *AuthService) authenticate(ctx context.Context, userName, password string, client dto.ClientInfo) (*models.Users, error) {
+	user, err := s.checkCredentials(ctx, userName, password, client.IP)
+	if err != nil {
+		s.audit.Record(ctx, AuditEntry{ActorName: userName, Action: AuditLogin, Client: client, Diff: map[string]string{"reason": err.Error()}})
+		return nil, err
 	}
+	return user, nil
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(req.Password)); err != nil {
-		return dto.LoginResponse{}, errors.New("invalid username or password")
+// checkCredentials checks a username/password pair with the configured
+// backends and returns the matching user. Failures are throttled per username
+// and client IP; a throttled attempt returns a *LockedError without looking
+// at the password.
+func (s *AuthService) checkCredentials(ctx context.Context, userName, password, ip string) (*models.Users, error) {
+	if err := s.limiter.Check(ctx, userName, ip); err != nil {
+		return nil, err
 	}
 
-	exp := time.Minute * time.Duration(config.AppConfig.JWT.Expiration)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    user.Role,
-		"exp":     time.Now().Add(exp).Unix(),
-	})
+	local, err := findUser(ctx, s.userRepo, userName)
+	if err != nil {
+		return nil, err
+	}
+	if local != nil {
+		if err := s.limiter.CheckUser(local); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := s.tryAuthenticators(ctx, userName, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		if err := s.limiter.RecordFailure(ctx, local, userName, ip); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A directory may sign the name in as a local user of another name.
+	if local == nil || local.ID != user.ID {
+		if err := s.limiter.CheckUser(user); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.limiter.RecordSuccess(ctx, userName); err != nil {
+		return nil, err
+	}
+	if err := s.checkPasswordAllowed(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
 
-	secret := []byte(config.AppConfig.JWT.Secret)
-	signedToken, err := token.SignedString(secret)
+// checkPasswordAllowed refuses password and magic link logins for users whose
+// role requires a passkey. Users who have not registered one yet may still
+// use their password, or they could never log in to register it.
+func (s *AuthService) checkPasswordAllowed(ctx context.Context, user *models.Users) error {
+	required, err := s.roles.RequiresPasskey(ctx, user)
+	if err != nil || !required {
+		return err
+	}
+	count, err := s.passkeys.CountCredentials(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPasskeyRequired
+	}
+	return nil
+}
+
+// tryAuthenticators asks each configured backend in turn. If none accepts the
+// credentials and one of them failed, that failure is returned rather than
+// ErrInvalidCredentials, so an unreachable directory does not count towards
+// the user's lockout.
+func (s *AuthService) tryAuthenticators(ctx context.Context, userName, password string) (*models.Users, error) {
+	backends := config.AppConfig.Authentication.Backends
+	if len(backends) == 0 {
+		backends = []string{BackendLocal}
+	}
+	failure := ErrInvalidCredentials
+	for _, name := range backends {
+		authenticator, ok := s.authenticators[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown authentication backend %q", name)
+		}
+		user, err := authenticator.Authenticate(ctx, userName, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("authentication backend %s failed: %v", name, err)
+			failure = err
+		}
+	}
+	return nil, failure
+}
+
+// findUser looks the user up by name, returning nil if there is none.
+func findUser(ctx context.Context, userRepo repository.UserRepository, userName string) (*models.Users, error) {
+	user, err := userRepo.GetUserByUserName(ctx, userName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// startSession creates a session for the user and issues its first tokens.
+func (s *AuthService) startSession(ctx context.Context, user *models.Users, client dto.ClientInfo) (dto.LoginResponse, error) {
+	return s.startClientSession(ctx, user, "", client)
+}
+
+// startClientSession is startSession for tokens issued to the OAuth client
+// clientID.
+func (s *AuthService) startClientSession(ctx context.Context, user *models.Users, clientID string, client dto.ClientInfo) (dto.LoginResponse, error) {
+	sess, err := s.sessions.CreateForClient(ctx, user.ID, clientID, client, refreshTTL())
 	if err != nil {
 		return dto.LoginResponse{}, err
 	}
+	s.audit.Record(ctx, AuditEntry{ActorID: user.ID, ActorName: user.UserName, Action: AuditLogin, Success: true, Client: client, Diff: map[string]string{"session_id": sess.ID}})
+	return s.issueTokens(ctx, user, sess)
+}
+
+// Refresh exchanges a refresh token for a new access/refresh pair. Every
+// refresh token can be used once; presenting a used one again revokes the
+// whole session it belongs to, since only a stolen copy could be replayed.
+// Only tokens of first-party logins are accepted; see RefreshForClient.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (dto.LoginResponse, error) {
+	return s.refresh(ctx, refreshToken, "")
+}
+
+// RefreshForClient is Refresh for the token endpoint: the token must have been
+// issued to clientID.
+func (s *AuthService) RefreshForClient(ctx context.Context, refreshToken, clientID string) (dto.LoginResponse, error) {
+	return s.refresh(ctx, refreshToken, clientID)
+}
 
-	err = s.Redis.Set(ctx, "token:"+signedToken, user.ID, exp).Err()
+func (s *AuthService) refresh(ctx context.Context, refreshToken, clientID string) (dto.LoginResponse, error) {
+	hash := hashToken(refreshToken)
+	raw, err := s.Redis.Get(ctx, refreshKey(hash)).Result()
+	if err == redis.Nil {
+		return dto.LoginResponse{}, ErrInvalidRefreshToken
+	}
 	if err != nil {
 		return dto.LoginResponse{}, err
 	}
 
-	return dto.LoginResponse{Token: signedToken}, nil
+	var data refreshTokenData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	// Checked before the token is marked used, so another client presenting
+	// it can neither use it up nor end the session.
+	if data.ClientID != clientID {
+		return dto.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	// SETNX makes the "mark as used" step atomic, so two concurrent requests
+	// with the same token cannot both succeed.
+	first, err := s.Redis.SetNX(ctx, "refresh_used:"+hash, 1, refreshTTL()).Result()
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if !first {
+		log.Printf("refresh token reuse detected for user %d, revoking session %s", data.UserID, data.SessionID)
+		if err := s.sessions.Revoke(ctx, data.SessionID); err != nil {
+			return dto.LoginResponse{}, err
+		}
+		return dto.LoginResponse{}, ErrRefreshTokenReused
+	}
+
+	sess, err := s.sessions.Get(ctx, data.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return dto.LoginResponse{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	user, err := s.userRepo.GetUserByID(ctx, data.UserID)
+	if err != nil {
+		return dto.LoginResponse{}, ErrInvalidRefreshToken
+	}
+	if err := s.sessions.Extend(ctx, sess, refreshTTL()); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	return s.issueTokens(ctx, user, sess)
+}
+
+// Logout ends the session. Logging out of an impersonation session ends the
+// impersonation. Callers without a session, like API keys, get
+// ErrSessionNotFound.
+func (s *AuthService) Logout(ctx context.Context, userID uint, sessionID string, client dto.ClientInfo) error {
+	if sessionID == "" {
+		return ErrSessionNotFound
+	}
+	if sess, err := s.sessions.Get(ctx, sessionID); err == nil && sess.ImpersonatorID != 0 {
+		return s.EndImpersonation(ctx, sessionID, client)
+	}
+	if err := s.sessions.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{ActorID: userID, Action: AuditLogout, Success: true, Client: client, Diff: map[string]string{"session_id": sessionID}})
+	return nil
+}
+
+// UserName returns the login name of the user, for callers that only have
+// the ID from a token.
+func (s *AuthService) UserName(ctx context.Context, userID uint) (string, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.UserName, nil
+}
+
+// VerifyAccessToken checks the signature of an access token, that the session
+// it was issued in is still active and that no role or password change has
+// happened since it was issued.
+func (s *AuthService) VerifyAccessToken(ctx context.Context, tokenStr string) (*AccessClaims, error) {
+	claims, sess, err := s.checkAccessToken(ctx, tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.Touch(ctx, sess); err != nil {
+		log.Printf("failed to update last seen of session %s: %v", sess.ID, err)
+	}
+	return claims, nil
+}
+
+// checkAccessToken validates the signature, that the token was not revoked
+// and that its session and token version are still current.
+func (s *AuthService) checkAccessToken(ctx context.Context, tokenStr string) (*AccessClaims, *Session, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &AccessClaims{}, s.Keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, nil, ErrInvalidToken
+	}
+	claims := token.Claims.(*AccessClaims)
+	if claims.UserID == 0 || claims.SessionID == "" {
+		return nil, nil, ErrInvalidToken
+	}
+
+	revoked, err := s.denylist.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, ErrSessionRevoked
+	}
+	sess, err := s.sessions.Get(ctx, claims.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, nil, ErrSessionRevoked
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if sess.UserID != claims.UserID || sess.ImpersonatorID != claims.ActorID() {
+		return nil, nil, ErrInvalidToken
+	}
+	version, err := s.versions.Current(ctx, claims.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	if claims.TokenVersion < version {
+		return nil, nil, ErrTokenOutdated
+	}
+	if claims.Actor != nil {
+		version, err := s.versions.Current(ctx, claims.Actor.UserID)
+		if err != nil {
+			return nil, nil, ErrInvalidToken
+		}
+		if claims.Actor.TokenVersion < version {
+			return nil, nil, ErrTokenOutdated
+		}
+	}
+	return claims, sess, nil
+}
+
+// lookupRefreshToken returns the data of a refresh token that has not been
+// used yet.
+func (s *AuthService) lookupRefreshToken(ctx context.Context, refreshToken string) (*refreshTokenData, error) {
+	hash := hashToken(refreshToken)
+	raw, err := s.Redis.Get(ctx, refreshKey(hash)).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.Redis.Exists(ctx, "refresh_used:"+hash).Result()
+	if err != nil {
+		return nil, err
+	}
+	if used > 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+	var data refreshTokenData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// issueTokens signs a new access token and creates a new refresh token in the
+// session, recording it so it is deleted when the session is revoked.
+func (s *AuthService) issueTokens(ctx context.Context, user *models.Users, sess *Session) (dto.LoginResponse, error) {
+	signedToken, err := s.signAccessToken(ctx, user, sess, nil, accessTTL())
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+
+	refreshToken, err := generateRandomToken(32)
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	data, err := json.Marshal(refreshTokenData{UserID: user.ID, SessionID: sess.ID, ClientID: sess.ClientID})
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+
+	rKey := refreshKey(hashToken(refreshToken))
+	pipe := s.Redis.TxPipeline()
+	pipe.Set(ctx, rKey, data, refreshTTL())
+	pipe.SAdd(ctx, sessionRefreshKey(sess.ID), rKey)
+	pipe.Expire(ctx, sessionRefreshKey(sess.ID), refreshTTL())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return dto.LoginResponse{}, err
+	}
+
+	return dto.LoginResponse{Token: signedToken, RefreshToken: refreshToken}, nil
+}
+
+func (s *AuthService) signAccessToken(ctx context.Context, user *models.Users, sess *Session, actor *ActorClaim, ttl time.Duration) (string, error) {
+	jti, err := generateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	permissions, err := s.roles.PermissionsForUser(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return s.Keys.Sign(AccessClaims{
+		UserID:       user.ID,
+		Role:         user.Role,
+		Permissions:  permissions,
+		SessionID:    sess.ID,
+		TokenVersion: user.TokenVersion,
+		Actor:        actor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	})
+}
+
+func accessTTL() time.Duration {
+	return time.Minute * time.Duration(config.AppConfig.JWT.Expiration)
+}
+
+func refreshTTL() time.Duration {
+	return time.Minute * time.Duration(config.AppConfig.JWT.RefreshExpiration)
+}
+
+func refreshKey(hash string) string {
+	return "refresh:" + hash
 }
 
-func (s *AuthService) Logout(ctx context.Context, token string) error {
-	return s.Redis.Del(ctx, "token:"+token).Err()
+func challengeKey(hash string) string {
+	return "mfa_challenge:" + hash
 }
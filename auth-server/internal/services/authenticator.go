@@ -0,0 +1,67 @@
+package services
+
+import (
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"log"
+)
+
+const (
+	BackendLocal = "local"
+	BackendLDAP  = "ldap"
+)
+
+// Authenticator checks a username/password pair against one credential store
+// and returns the local user it belongs to. Wrong or unknown credentials are
+// reported as ErrInvalidCredentials, so the next backend can be tried; any
+// other error means the store could not be asked.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, userName, password string) (*models.Users, error)
+}
+
+// LocalAuthenticator checks passwords hashed in the users table.
+type LocalAuthenticator struct {
+	userRepo repository.UserRepository
+}
+
+func NewLocalAuthenticator(userRepo repository.UserRepository) *LocalAuthenticator {
+	return &LocalAuthenticator{userRepo: userRepo}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return BackendLocal
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, userName, password string) (*models.Users, error) {
+	user, err := findUser(ctx, a.userRepo, userName)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		checkDummyPassword(password)
+		return nil, ErrInvalidCredentials
+	}
+	if !CheckPassword(user.HashedPassword, password) {
+		return nil, ErrInvalidCredentials
+	}
+	if PasswordNeedsRehash(user.HashedPassword) {
+		go a.rehashPassword(user.ID, user.HashedPassword, password)
+	}
+	return user, nil
+}
+
+// rehashPassword upgrades a stored hash to the configured algorithm and
+// parameters. The password itself is unchanged, so tokens and sessions are
+// left alone.
+func (a *LocalAuthenticator) rehashPassword(userID uint, oldHash, password string) {
+	newHash, err := HashPassword(password)
+	if err != nil {
+		log.Printf("failed to rehash password of user %d: %v", userID, err)
+		return
+	}
+	if err := a.userRepo.ReplacePasswordHash(context.Background(), userID, oldHash, newHash); err != nil {
+		log.Printf("failed to store rehashed password of user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// User codes use consonants only, so they cannot spell words and are easy
+	// to type: 20^8 combinations, shown as XXXX-XXXX.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	deviceSlowDownStep = 5 * time.Second
+)
+
+var ErrInvalidUserCode = errors.New("invalid or expired user code")
+
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+)
+
+// deviceAuthorization is stored in Redis under device_code:<sha256(device
+// code)> until it is redeemed or expires; device_user_code:<user code> points
+// at it. Only ApproveDevice writes the record after it is created, and only
+// while it is pending; polling keeps its state in separate keys.
+type deviceAuthorization struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	UserCode string `json:"user_code"`
+	Status   string `json:"status"`
+	// Interval is the minimum polling interval in seconds the client was
+	// given. Each slow_down adds to it under device_slow_down:<sha256(device
+	// code)>.
+	Interval int  `json:"interval"`
+	UserID   uint `json:"user_id,omitempty"`
+	// The browser the user approved the request from, recorded on the
+	// session.
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// DeviceAuthorization starts an RFC 8628 device authorization for an
+// authenticated client. The client shows the user code and verification URI
+// to the user and polls the token endpoint with the device code.
+func (s *OIDCService) DeviceAuthorization(ctx context.Context, client *models.OAuthClient, scope string) (dto.DeviceAuthorizationResponse, error) {
+	deviceCode, err := generateRandomToken(32)
+	if err != nil {
+		return dto.DeviceAuthorizationResponse{}, err
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return dto.DeviceAuthorizationResponse{}, err
+	}
+	auth := deviceAuthorization{
+		ClientID: client.ClientID,
+		Scope:    scope,
+		UserCode: userCode,
+		Status:   deviceStatusPending,
+		Interval: devicePollInterval(),
+	}
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return dto.DeviceAuthorizationResponse{}, err
+	}
+
+	ttl := deviceCodeTTL()
+	deviceKey := deviceCodeKey(deviceCode)
+	// A user code collision is unlikely but would hand one user's approval
+	// to another device, so the code is claimed with SETNX.
+	ok, err := s.auth.Redis.SetNX(ctx, deviceUserCodeKey(userCode), hashToken(deviceCode), ttl).Result()
+	if err != nil {
+		return dto.DeviceAuthorizationResponse{}, err
+	}
+	if !ok {
+		return dto.DeviceAuthorizationResponse{}, errors.New("user code collision, try again")
+	}
+	if err := s.auth.Redis.Set(ctx, deviceKey, data, ttl).Err(); err != nil {
+		return dto.DeviceAuthorizationResponse{}, err
+	}
+
+	verificationURI := s.Issuer() + "/device"
+	return dto.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + formatUserCode(userCode),
+		ExpiresIn:               int(ttl.Seconds()),
+		Interval:                auth.Interval,
+	}, nil
+}
+
+// ApproveDevice records the user's decision on the device authorization
+// with the given user code. The record is watched from read to write, so a
+// concurrent decision, redemption or expiry makes this one fail instead of
+// overwriting it or recreating the record.
+func (s *OIDCService) ApproveDevice(ctx context.Context, userCode string, user *models.Users, approve bool, client dto.ClientInfo) error {
+	hash, err := s.auth.Redis.Get(ctx, deviceUserCodeKey(normalizeUserCode(userCode))).Result()
+	if err == redis.Nil {
+		return ErrInvalidUserCode
+	}
+	if err != nil {
+		return err
+	}
+	key := "device_code:" + hash
+	var auth *deviceAuthorization
+	err = s.auth.Redis.Watch(ctx, func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return ErrInvalidUserCode
+		}
+		if err != nil {
+			return err
+		}
+		auth, err = parseDeviceAuthorization(raw)
+		if err != nil {
+			return err
+		}
+		if auth.Status != deviceStatusPending {
+			return ErrInvalidUserCode
+		}
+
+		auth.Status = deviceStatusDenied
+		if approve {
+			auth.Status = deviceStatusApproved
+			auth.UserID = user.ID
+			auth.IP, auth.UserAgent = client.IP, client.UserAgent
+		}
+		data, err := json.Marshal(auth)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetXX(ctx, key, data, redis.KeepTTL)
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return ErrInvalidUserCode
+	}
+	if err != nil {
+		return err
+	}
+	// The user code is done with either way.
+	return s.auth.Redis.Del(ctx, deviceUserCodeKey(auth.UserCode)).Err()
+}
+
+// exchangeDeviceCode answers a token request polling for a device
+// authorization. Polling faster than the interval returns slow_down and
+// lengthens the interval by five seconds, as RFC 8628 asks of clients.
+func (s *OIDCService) exchangeDeviceCode(ctx context.Context, client *models.OAuthClient, req *dto.TokenRequest) (dto.TokenResponse, error) {
+	if req.DeviceCode == "" {
+		return dto.TokenResponse{}, oauthError("invalid_request", "device_code is required")
+	}
+	hash := hashToken(req.DeviceCode)
+	key := deviceCodeKey(req.DeviceCode)
+	auth, err := s.loadDeviceAuthorization(ctx, key)
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	if auth == nil {
+		return dto.TokenResponse{}, oauthError("expired_token", "device code is invalid or has expired")
+	}
+	if auth.ClientID != client.ClientID {
+		return dto.TokenResponse{}, oauthError("invalid_grant", "device code was issued to another client")
+	}
+
+	slowDown, err := s.auth.Redis.Get(ctx, "device_slow_down:"+hash).Int()
+	if err != nil && err != redis.Nil {
+		return dto.TokenResponse{}, err
+	}
+	interval := time.Duration(auth.Interval)*time.Second + time.Duration(slowDown)*time.Second
+	first, err := s.auth.Redis.SetNX(ctx, "device_poll:"+hash, 1, interval).Result()
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	if !first {
+		pipe := s.auth.Redis.TxPipeline()
+		pipe.IncrBy(ctx, "device_slow_down:"+hash, int64(deviceSlowDownStep.Seconds()))
+		pipe.Expire(ctx, "device_slow_down:"+hash, deviceCodeTTL())
+		if _, err := pipe.Exec(ctx); err != nil {
+			return dto.TokenResponse{}, err
+		}
+		return dto.TokenResponse{}, oauthError("slow_down", "polling too fast, wait longer between requests")
+	}
+
+	switch auth.Status {
+	case deviceStatusPending:
+		return dto.TokenResponse{}, oauthError("authorization_pending", "the user has not yet approved the request")
+	case deviceStatusDenied:
+		s.auth.Redis.Del(ctx, key)
+		return dto.TokenResponse{}, oauthError("access_denied", "the user denied the request")
+	}
+
+	// GETDEL is what makes the approval single-use: only one poll gets the
+	// record back.
+	raw, err := s.auth.Redis.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return dto.TokenResponse{}, oauthError("expired_token", "device code is invalid or has expired")
+	}
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	if auth, err = parseDeviceAuthorization(raw); err != nil {
+		return dto.TokenResponse{}, err
+	}
+	if auth.Status != deviceStatusApproved || auth.ClientID != client.ClientID {
+		return dto.TokenResponse{}, oauthError("invalid_grant", "device code cannot be redeemed")
+	}
+	user, err := s.userRepo.GetUserByID(ctx, auth.UserID)
+	if err != nil {
+		return dto.TokenResponse{}, oauthError("invalid_grant", "user no longer exists")
+	}
+	tokens, err := s.auth.startClientSession(ctx, user, client.ClientID, dto.ClientInfo{IP: auth.IP, UserAgent: auth.UserAgent})
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	resp := bearerResponse(tokens)
+	resp.Scope = auth.Scope
+	return resp, nil
+}
+
+// loadDeviceAuthorization returns nil when the record does not exist.
+func (s *OIDCService) loadDeviceAuthorization(ctx context.Context, key string) (*deviceAuthorization, error) {
+	raw, err := s.auth.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDeviceAuthorization(raw)
+}
+
+func parseDeviceAuthorization(raw string) (*deviceAuthorization, error) {
+	var auth deviceAuthorization
+	if err := json.Unmarshal([]byte(raw), &auth); err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode accepts user codes typed in lower case or without the
+// dash.
+func normalizeUserCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func deviceCodeTTL() time.Duration {
+	if seconds := config.AppConfig.OIDC.DeviceCodeExpiration; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 10 * time.Minute
+}
+
+func devicePollInterval() int {
+	if interval := config.AppConfig.OIDC.DevicePollInterval; interval > 0 {
+		return interval
+	}
+	return 5
+}
+
+func deviceCodeKey(deviceCode string) string {
+	return "device_code:" + hashToken(deviceCode)
+}
+
+func deviceUserCodeKey(userCode string) string {
+	return "device_user_code:" + userCode
+}
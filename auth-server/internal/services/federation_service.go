@@ -0,0 +1,243 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/oauth2"
+)
+
+const federationStateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+	ErrInvalidFederationState  = errors.New("invalid or expired login state")
+	ErrFederationBrowser       = errors.New("login must be completed in the browser that started it")
+	ErrFederatedLogin          = errors.New("identity provider login failed")
+)
+
+// federationState is stored in Redis under federation_state:<sha256(state)>
+// between the redirect to the provider and its callback.
+type federationState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// federatedProvider is a provider whose discovery document has been fetched.
+type federatedProvider struct {
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// FederationService lets users log in through external OIDC providers, using
+// the authorization code flow with PKCE. The first login creates a local user
+// linked to the provider account by an Identity row; every login re-applies
+// the provider's role mappings.
+type FederationService struct {
+	linker *identityLinker
+	auth   *AuthService
+	Redis  *redis.Client
+
+	mu        sync.Mutex
+	providers map[string]*federatedProvider
+}
+
+func NewFederationService(identities repository.IdentityRepository, userRepo repository.UserRepository, roles *RoleService, versions *TokenVersionStore, auth *AuthService, Redis *redis.Client) *FederationService {
+	linker := &identityLinker{identities: identities, userRepo: userRepo, roles: roles, versions: versions}
+	return &FederationService{linker: linker, auth: auth, Redis: Redis, providers: map[string]*federatedProvider{}}
+}
+
+// Providers returns the names of the configured providers.
+func (s *FederationService) Providers() []string {
+	names := []string{}
+	for _, p := range config.AppConfig.Federation.Providers {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Begin starts a login at the provider. It returns the URL to redirect the
+// browser to and the state, which the browser must present again to Complete
+// so that a callback cannot be replayed into another browser (login CSRF).
+func (s *FederationService) Begin(ctx context.Context, providerName string) (string, string, error) {
+	cfg, err := providerConfig(providerName)
+	if err != nil {
+		return "", "", err
+	}
+	provider, err := s.provider(cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := generateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := generateRandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	st := federationState{Provider: cfg.Name, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.Redis.Set(ctx, federationStateKey(state), data, federationStateTTL).Err(); err != nil {
+		return "", "", err
+	}
+	return provider.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(st.Verifier)), state, nil
+}
+
+// Complete handles the provider's callback: it redeems the code, validates
+// the ID token against the provider's JWKS and starts a session for the
+// linked local user. browserState is the state Begin handed to the browser;
+// it must match the callback's. Local 2FA is not asked for; the provider is
+// trusted to have authenticated the user.
+func (s *FederationService) Complete(ctx context.Context, providerName, code, state, browserState string, client dto.ClientInfo) (dto.LoginResponse, error) {
+	cfg, err := providerConfig(providerName)
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return dto.LoginResponse{}, ErrFederationBrowser
+	}
+	raw, err := s.Redis.GetDel(ctx, federationStateKey(state)).Result()
+	if err == redis.Nil {
+		return dto.LoginResponse{}, ErrInvalidFederationState
+	}
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	var st federationState
+	if err := json.Unmarshal([]byte(raw), &st); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if st.Provider != cfg.Name {
+		return dto.LoginResponse{}, ErrInvalidFederationState
+	}
+
+	provider, err := s.provider(cfg)
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	token, err := provider.oauth.Exchange(ctx, code, oauth2.VerifierOption(st.Verifier))
+	if err != nil {
+		return dto.LoginResponse{}, fmt.Errorf("%w: %v", ErrFederatedLogin, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return dto.LoginResponse{}, fmt.Errorf("%w: no id_token in token response", ErrFederatedLogin)
+	}
+	idToken, err := provider.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return dto.LoginResponse{}, fmt.Errorf("%w: %v", ErrFederatedLogin, err)
+	}
+	if idToken.Nonce != st.Nonce {
+		return dto.LoginResponse{}, fmt.Errorf("%w: nonce mismatch", ErrFederatedLogin)
+	}
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return dto.LoginResponse{}, err
+	}
+
+	usernameClaim := cfg.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	acct := externalAccount{Provider: cfg.Name, Subject: idToken.Subject, Role: mapRole(cfg, claims)}
+	acct.UserName, _ = claims[usernameClaim].(string)
+	acct.Email, _ = claims["email"].(string)
+	acct.EmailVerified, _ = claims["email_verified"].(bool)
+	user, err := s.linker.link(ctx, acct)
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	return s.auth.startSession(ctx, user, client)
+}
+
+// provider returns the provider's OAuth2 config and ID token verifier,
+// fetching its discovery document on first use.
+func (s *FederationService) provider(cfg *config.IdentityProviderConfig) (*federatedProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.providers[cfg.Name]; ok {
+		return p, nil
+	}
+
+	// The provider keeps this context to refresh its JWKS later, so it must
+	// not be the request's.
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: 10 * time.Second})
+	discovered, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover identity provider %s: %w", cfg.Name, err)
+	}
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range cfg.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	p := &federatedProvider{
+		oauth: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: discovered.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}
+	s.providers[cfg.Name] = p
+	return p, nil
+}
+
+func providerConfig(name string) (*config.IdentityProviderConfig, error) {
+	for i := range config.AppConfig.Federation.Providers {
+		if p := &config.AppConfig.Federation.Providers[i]; p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, ErrUnknownIdentityProvider
+}
+
+// mapRole applies the provider's role mappings to the ID token claims.
+func mapRole(cfg *config.IdentityProviderConfig, claims map[string]interface{}) string {
+	for _, m := range cfg.RoleMappings {
+		if claimMatches(claims[m.Claim], m.Value) {
+			return m.Role
+		}
+	}
+	if cfg.DefaultRole != "" {
+		return cfg.DefaultRole
+	}
+	return string(models.RoleUser)
+}
+
+func claimMatches(claim interface{}, value string) bool {
+	if list, ok := claim.([]interface{}); ok {
+		for _, v := range list {
+			if fmt.Sprint(v) == value {
+				return true
+			}
+		}
+		return false
+	}
+	return claim != nil && fmt.Sprint(claim) == value
+}
+
+func federationStateKey(state string) string {
+	return "federation_state:" + hashToken(state)
+}
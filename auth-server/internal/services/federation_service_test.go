@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/keys"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// mockProvider is a minimal OIDC provider: discovery, JWKS and a token
+// endpoint that answers every code with an ID token for subject "alice".
+type mockProvider struct {
+	*httptest.Server
+	// nonces maps issued codes to the nonce of their authorization request.
+	nonces map[string]string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	p := &mockProvider{nonces: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		nonce, ok := p.nonces[r.PostForm.Get("code")]
+		if !ok || r.PostForm.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                p.URL,
+			"sub":                "alice",
+			"aud":                "auth-server",
+			"iat":                now.Unix(),
+			"exp":                now.Add(time.Minute).Unix(),
+			"nonce":              nonce,
+			"preferred_username": "alice",
+		})
+		token.Header["kid"] = "mock"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "mock-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize plays the user approving the login at the provider and returns
+// the code and state of the redirect back.
+func (p *mockProvider) authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth URL: %v", err)
+	}
+	q := u.Query()
+	code := "code-" + q.Get("state")[:8]
+	p.nonces[code] = q.Get("nonce")
+	return code, q.Get("state")
+}
+
+type memUserRepo struct {
+	repository.UserRepository
+	users []*models.Users
+}
+
+func (r *memUserRepo) GetUserByID(ctx context.Context, id uint) (*models.Users, error) {
+	for _, u := range r.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memUserRepo) GetUserByUserName(ctx context.Context, userName string) (*models.Users, error) {
+	for _, u := range r.users {
+		if strings.EqualFold(u.UserName, userName) {
+			return u, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type memIdentityRepo struct {
+	users      *memUserRepo
+	identities []*models.Identity
+}
+
+func (r *memIdentityRepo) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	for _, i := range r.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memIdentityRepo) CreateUserWithIdentity(ctx context.Context, user *models.Users, identity *models.Identity) error {
+	user.ID = uint(len(r.users.users) + 1)
+	r.users.users = append(r.users.users, user)
+	identity.UserID = user.ID
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *memIdentityRepo) TouchIdentity(ctx context.Context, id uint, at time.Time) error {
+	return nil
+}
+
+func (r *memIdentityRepo) HasIdentity(ctx context.Context, userID uint) (bool, error) {
+	for _, i := range r.identities {
+		if i.UserID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memRoleRepo struct {
+	repository.RoleRepository
+}
+
+func (r *memRoleRepo) GetRolesByNames(ctx context.Context, names []string) ([]*models.Roles, error) {
+	return []*models.Roles{{Name: names[0]}}, nil
+}
+
+func (r *memRoleRepo) GetUserPermissions(ctx context.Context, userID uint) ([]string, error) {
+	return []string{}, nil
+}
+
+type memAuditRepo struct {
+	repository.AuditEventRepository
+}
+
+func (r *memAuditRepo) AppendEvent(ctx context.Context, event *models.AuditEvent) error {
+	return nil
+}
+
+func setupFederation(t *testing.T) (*FederationService, *mockProvider, *memIdentityRepo) {
+	t.Helper()
+	provider := newMockProvider(t)
+	config.AppConfig = &config.Config{
+		JWT: config.JWTConfig{Expiration: 60, RefreshExpiration: 600, SigningKeys: []config.SigningKeyConfig{
+			{ID: "test", Algorithm: "EdDSA", PrivateKeyFile: t.TempDir() + "/test.pem"},
+		}},
+		Federation: config.FederationConfig{Providers: []config.IdentityProviderConfig{{
+			Name:        "mock",
+			Issuer:      provider.URL,
+			ClientID:    "auth-server",
+			RedirectURL: "http://localhost/api/federation/mock/callback",
+		}}},
+	}
+	keySet, err := keys.Load(config.AppConfig.JWT)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+
+	users := &memUserRepo{}
+	identities := &memIdentityRepo{users: users}
+	versions := NewTokenVersionStore(users, rdb)
+	roles := NewRoleService(&memRoleRepo{}, versions)
+	limiter := NewLoginLimiter(users, rdb)
+	auth := NewAuthService(users, NewSessionService(rdb), versions, roles, NewTwoFactorService(users, nil, limiter, rdb), limiter, NewTokenDenylist(rdb), nil, NewAuditService(&memAuditRepo{}, users), nil, rdb, keySet)
+	return NewFederationService(identities, users, roles, versions, auth, rdb), provider, identities
+}
+
+func TestFederationLogin(t *testing.T) {
+	ctx := context.Background()
+	client := dto.ClientInfo{IP: "127.0.0.1"}
+
+	t.Run("completes in the browser that started it", func(t *testing.T) {
+		s, provider, identities := setupFederation(t)
+		authURL, browserState, err := s.Begin(ctx, "mock")
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		code, state := provider.authorize(t, authURL)
+		if state != browserState {
+			t.Fatalf("state sent to provider %q, browser got %q", state, browserState)
+		}
+		resp, err := s.Complete(ctx, "mock", code, state, browserState, client)
+		if err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+		if resp.Token == "" || resp.RefreshToken == "" {
+			t.Fatalf("missing tokens: %+v", resp)
+		}
+		if len(identities.identities) != 1 || identities.identities[0].Subject != "alice" {
+			t.Fatalf("identity not linked: %+v", identities.identities)
+		}
+
+		_, err = s.Complete(ctx, "mock", code, state, browserState, client)
+		if !errors.Is(err, ErrInvalidFederationState) {
+			t.Fatalf("replayed callback: err = %v, want %v", err, ErrInvalidFederationState)
+		}
+	})
+
+	t.Run("rejects a callback without the state cookie", func(t *testing.T) {
+		s, provider, _ := setupFederation(t)
+		authURL, _, err := s.Begin(ctx, "mock")
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		code, state := provider.authorize(t, authURL)
+		_, err = s.Complete(ctx, "mock", code, state, "", client)
+		if !errors.Is(err, ErrFederationBrowser) {
+			t.Fatalf("err = %v, want %v", err, ErrFederationBrowser)
+		}
+	})
+
+	t.Run("rejects a callback started in another browser", func(t *testing.T) {
+		s, provider, identities := setupFederation(t)
+		// The attacker starts a login and has the victim's browser, which has
+		// a login of its own in progress, open the callback.
+		attackerURL, _, err := s.Begin(ctx, "mock")
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		_, victimState, err := s.Begin(ctx, "mock")
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		code, state := provider.authorize(t, attackerURL)
+		_, err = s.Complete(ctx, "mock", code, state, victimState, client)
+		if !errors.Is(err, ErrFederationBrowser) {
+			t.Fatalf("err = %v, want %v", err, ErrFederationBrowser)
+		}
+		if len(identities.identities) != 0 {
+			t.Fatalf("identity linked: %+v", identities.identities)
+		}
+	})
+
+	t.Run("rejects an unknown state", func(t *testing.T) {
+		s, _, _ := setupFederation(t)
+		_, err := s.Complete(ctx, "mock", "code", "forged", "forged", client)
+		if !errors.Is(err, ErrInvalidFederationState) {
+			t.Fatalf("err = %v, want %v", err, ErrInvalidFederationState)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// externalAccount is a user as described by an external identity source: an
+// OIDC provider or a directory.
+type externalAccount struct {
+	// Provider and Subject identify the account in the identities table.
+	Provider      string
+	Subject       string
+	UserName      string
+	Email         string
+	EmailVerified bool
+	Role          string
+}
+
+// identityLinker maps external accounts to local users, creating the user on
+// first login and syncing role and email on every login after that.
+type identityLinker struct {
+	identities repository.IdentityRepository
+	userRepo   repository.UserRepository
+	roles      *RoleService
+	versions   *TokenVersionStore
+}
+
+func (l *identityLinker) link(ctx context.Context, acct externalAccount) (*models.Users, error) {
+	exists, err := l.roles.RoleExists(ctx, acct.Role)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRole, acct.Role)
+	}
+
+	identity, err := l.identities.GetIdentity(ctx, acct.Provider, acct.Subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return l.createUser(ctx, acct)
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := l.userRepo.GetUserByID(ctx, identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.sync(ctx, user, acct); err != nil {
+		return nil, err
+	}
+	if err := l.identities.TouchIdentity(ctx, identity.ID, time.Now()); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// sync copies the role, and the email if it is verified and not used by
+// another user, from the external account.
+func (l *identityLinker) sync(ctx context.Context, user *models.Users, acct externalAccount) error {
+	updates := map[string]interface{}{}
+	if user.Role != acct.Role {
+		updates["role"] = acct.Role
+	}
+	if email := l.usableEmail(ctx, acct); email != nil && (user.Email == nil || *user.Email != *email) {
+		updates["email"] = *email
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := l.userRepo.UpdateUser(ctx, user.ID, updates); err != nil {
+		return err
+	}
+	if _, ok := updates["role"]; ok {
+		if err := l.versions.Bump(ctx, user.ID); err != nil {
+			return err
+		}
+		user.Role = acct.Role
+	}
+	if email, ok := updates["email"].(string); ok {
+		user.Email = &email
+	}
+	return nil
+}
+
+// createUser creates the local user for a first login. Existing local
+// accounts are never linked by matching name or email, since the external
+// source does not prove ownership of them; the new user gets a different
+// name and no email instead.
+func (l *identityLinker) createUser(ctx context.Context, acct externalAccount) (*models.Users, error) {
+	userName, err := l.newUserName(ctx, acct)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.Users{UserName: userName, Email: l.usableEmail(ctx, acct), Role: acct.Role}
+	now := time.Now()
+	identity := &models.Identity{Provider: acct.Provider, Subject: acct.Subject, Email: acct.Email, LastLoginAt: &now}
+	if err := l.identities.CreateUserWithIdentity(ctx, user, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (l *identityLinker) newUserName(ctx context.Context, acct externalAccount) (string, error) {
+	candidates := []string{}
+	if acct.UserName != "" {
+		candidates = append(candidates, acct.UserName)
+	}
+	if acct.Email != "" {
+		candidates = append(candidates, acct.Email)
+	}
+	candidates = append(candidates, acct.Provider+"_"+acct.Subject)
+	for _, name := range candidates {
+		_, err := l.userRepo.GetUserByUserName(ctx, name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free user name for %s account %s", acct.Provider, acct.Subject)
+}
+
+// usableEmail returns the normalized email of the account if it is verified
+// and no other user has it.
+func (l *identityLinker) usableEmail(ctx context.Context, acct externalAccount) *string {
+	if !acct.EmailVerified || acct.Email == "" {
+		return nil
+	}
+	email := NormalizeEmail(acct.Email)
+	if _, err := l.userRepo.GetUserByEmail(ctx, email); !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return &email
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrImpersonationTarget = errors.New("user not found")
+	ErrImpersonateSelf     = errors.New("cannot impersonate yourself")
+	ErrImpersonateAdmin    = errors.New("admins cannot be impersonated")
+	ErrImpersonateStronger = errors.New("cannot impersonate a user with permissions you do not have")
+	ErrNotImpersonating    = errors.New("session is not an impersonation")
+)
+
+// Impersonate starts a session in which actorID, who holds users:impersonate,
+// acts as userID, so support staff see what the user sees. The session only
+// gets an access token, carrying the actor in its "act" claim, and cannot be
+// refreshed; it lasts until EndImpersonation or
+// config.Impersonation.TokenExpiration. Admins cannot be impersonated, nor
+// can users with any permission the actor lacks, as that would grant it to
+// the actor. Attempts are recorded in the audit log either way.
+func (s *AuthService) Impersonate(ctx context.Context, actorID, userID uint, client dto.ClientInfo) (dto.ImpersonationResponse, error) {
+	resp, err := s.impersonate(ctx, actorID, userID, client)
+	entry := AuditEntry{ActorID: actorID, TargetID: userID, Action: AuditImpersonateStart, Success: err == nil, Client: client}
+	if err != nil {
+		entry.Diff = map[string]string{"reason": err.Error()}
+	} else {
+		entry.Diff = map[string]string{"session_id": resp.SessionID}
+	}
+	s.audit.Record(ctx, entry)
+	return resp, err
+}
+
+func (s *AuthService) impersonate(ctx context.Context, actorID, userID uint, client dto.ClientInfo) (dto.ImpersonationResponse, error) {
+	if actorID == userID {
+		return dto.ImpersonationResponse{}, ErrImpersonateSelf
+	}
+	actor, err := s.userRepo.GetUserByID(ctx, actorID)
+	if err != nil {
+		return dto.ImpersonationResponse{}, err
+	}
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return dto.ImpersonationResponse{}, ErrImpersonationTarget
+	}
+	if err != nil {
+		return dto.ImpersonationResponse{}, err
+	}
+	if user.Role == string(models.RoleAdmin) {
+		return dto.ImpersonationResponse{}, ErrImpersonateAdmin
+	}
+	actorPermissions, err := s.roles.PermissionsForUser(ctx, actor.ID)
+	if err != nil {
+		return dto.ImpersonationResponse{}, err
+	}
+	userPermissions, err := s.roles.PermissionsForUser(ctx, user.ID)
+	if err != nil {
+		return dto.ImpersonationResponse{}, err
+	}
+	if slices.Contains(userPermissions, models.PermissionAll) {
+		return dto.ImpersonationResponse{}, ErrImpersonateAdmin
+	}
+	if !HasAllPermissions(actorPermissions, userPermissions) {
+		return dto.ImpersonationResponse{}, ErrImpersonateStronger
+	}
+
+	ttl := impersonationTTL()
+	sess, err := s.sessions.CreateImpersonation(ctx, user.ID, actor.ID, client, ttl)
+	if err != nil {
+		return dto.ImpersonationResponse{}, err
+	}
+	token, err := s.signAccessToken(ctx, user, sess, &ActorClaim{
+		Subject:      strconv.FormatUint(uint64(actor.ID), 10),
+		UserID:       actor.ID,
+		UserName:     actor.UserName,
+		TokenVersion: actor.TokenVersion,
+	}, ttl)
+	if err != nil {
+		s.sessions.Revoke(ctx, sess.ID)
+		return dto.ImpersonationResponse{}, err
+	}
+	return dto.ImpersonationResponse{Token: token, SessionID: sess.ID, ExpiresAt: sess.ExpiresAt}, nil
+}
+
+// EndImpersonation revokes an impersonation session and records its end.
+func (s *AuthService) EndImpersonation(ctx context.Context, sessionID string, client dto.ClientInfo) error {
+	sess, err := s.sessions.Get(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return ErrNotImpersonating
+	}
+	if err != nil {
+		return err
+	}
+	if sess.ImpersonatorID == 0 {
+		return ErrNotImpersonating
+	}
+	if err := s.sessions.Revoke(ctx, sess.ID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, AuditEntry{ActorID: sess.ImpersonatorID, TargetID: sess.UserID, Action: AuditImpersonateEnd, Success: true, Client: client, Diff: map[string]string{"session_id": sess.ID}})
+	return nil
+}
+
+func impersonationTTL() time.Duration {
+	if seconds := config.AppConfig.Impersonation.TokenExpiration; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 15 * time.Minute
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntrospectionService implements RFC 7662 introspection and RFC 7009
+// revocation for the tokens this server issues: user access and refresh
+// tokens and client_credentials tokens.
+type IntrospectionService struct {
+	auth     *AuthService
+	clients  *ServiceClientService
+	denylist *TokenDenylist
+}
+
+func NewIntrospectionService(auth *AuthService, clients *ServiceClientService, denylist *TokenDenylist) *IntrospectionService {
+	return &IntrospectionService{auth: auth, clients: clients, denylist: denylist}
+}
+
+// Introspect reports whether token is currently usable. Anything that does
+// not verify, including tokens of revoked sessions, is just inactive; errors
+// are returned only when the state could not be checked.
+func (s *IntrospectionService) Introspect(ctx context.Context, token, hint string) (dto.IntrospectionResponse, error) {
+	if token == "" {
+		return dto.IntrospectionResponse{}, nil
+	}
+	if hint == "refresh_token" {
+		if resp, err := s.introspectRefreshToken(ctx, token); err != nil || resp.Active {
+			return resp, err
+		}
+		return s.introspectAccessToken(ctx, token)
+	}
+	if resp, err := s.introspectAccessToken(ctx, token); err != nil || resp.Active {
+		return resp, err
+	}
+	return s.introspectRefreshToken(ctx, token)
+}
+
+func (s *IntrospectionService) introspectAccessToken(ctx context.Context, token string) (dto.IntrospectionResponse, error) {
+	claims, _, err := s.auth.checkAccessToken(ctx, token)
+	if err == nil {
+		resp := dto.IntrospectionResponse{
+			Active:    true,
+			Sub:       claims.Subject,
+			Role:      claims.Role,
+			Scope:     strings.Join(claims.Permissions, " "),
+			TokenType: "access_token",
+			Exp:       claims.ExpiresAt.Unix(),
+			Iat:       claims.IssuedAt.Unix(),
+			JTI:       claims.ID,
+		}
+		if claims.Actor != nil {
+			resp.Act = &dto.IntrospectionActor{Sub: claims.Actor.Subject}
+		}
+		return resp, nil
+	}
+	if !isInactiveTokenError(err) {
+		return dto.IntrospectionResponse{}, err
+	}
+
+	clientClaims, err := s.clients.VerifyToken(ctx, token)
+	if errors.Is(err, ErrInvalidToken) {
+		return dto.IntrospectionResponse{}, nil
+	}
+	if err != nil {
+		return dto.IntrospectionResponse{}, err
+	}
+	return dto.IntrospectionResponse{
+		Active:    true,
+		Sub:       clientClaims.Subject,
+		ClientID:  clientClaims.ClientID,
+		Scope:     clientClaims.Scope,
+		TokenType: "access_token",
+		Exp:       clientClaims.ExpiresAt.Unix(),
+		Iat:       clientClaims.IssuedAt.Unix(),
+		JTI:       clientClaims.ID,
+	}, nil
+}
+
+// introspectRefreshToken treats a refresh token as active while it is unused
+// and its session still exists.
+func (s *IntrospectionService) introspectRefreshToken(ctx context.Context, token string) (dto.IntrospectionResponse, error) {
+	data, err := s.auth.lookupRefreshToken(ctx, token)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return dto.IntrospectionResponse{}, nil
+	}
+	if err != nil {
+		return dto.IntrospectionResponse{}, err
+	}
+	sess, err := s.auth.sessions.Get(ctx, data.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return dto.IntrospectionResponse{}, nil
+	}
+	if err != nil {
+		return dto.IntrospectionResponse{}, err
+	}
+	if sess.UserID != data.UserID {
+		return dto.IntrospectionResponse{}, nil
+	}
+	user, err := s.auth.userRepo.GetUserByID(ctx, data.UserID)
+	if err != nil {
+		return dto.IntrospectionResponse{}, nil
+	}
+	permissions, err := s.auth.roles.PermissionsForUser(ctx, user.ID)
+	if err != nil {
+		return dto.IntrospectionResponse{}, err
+	}
+	ttl, err := s.auth.Redis.TTL(ctx, refreshKey(hashToken(token))).Result()
+	if err != nil {
+		return dto.IntrospectionResponse{}, err
+	}
+	return dto.IntrospectionResponse{
+		Active:    true,
+		Sub:       strconv.FormatUint(uint64(user.ID), 10),
+		Role:      user.Role,
+		Scope:     strings.Join(permissions, " "),
+		ClientID:  data.ClientID,
+		TokenType: "refresh_token",
+		Exp:       time.Now().Add(ttl).Unix(),
+	}, nil
+}
+
+// Revoke invalidates token. Access tokens are denylisted until they expire;
+// a refresh token ends its whole session, as logging out would. A client may
+// revoke user tokens and its own client_credentials tokens only. Unknown or
+// already invalid tokens are not an error (RFC 7009 section 2.2).
+func (s *IntrospectionService) Revoke(ctx context.Context, caller *models.ServiceClient, token, hint string) error {
+	if token == "" {
+		return nil
+	}
+	if hint != "refresh_token" {
+		if claims, _, err := s.auth.checkAccessToken(ctx, token); err == nil {
+			return s.denylist.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+		}
+		if claims, err := s.clients.VerifyToken(ctx, token); err == nil {
+			if claims.ClientID != caller.ClientID {
+				return oauthError("unauthorized_client", "the token was issued to another client")
+			}
+			return s.denylist.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+		}
+	}
+	data, err := s.auth.lookupRefreshToken(ctx, token)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.auth.sessions.Revoke(ctx, data.SessionID)
+}
+
+func isInactiveTokenError(err error) bool {
+	return errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrSessionRevoked) || errors.Is(err, ErrTokenOutdated)
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPAuthenticator checks passwords against an LDAP directory or Active
+// Directory. Directory users are created locally on first login, linked in
+// the identities table under the "ldap" provider, and their role and email
+// are synced from the directory on every login.
+type LDAPAuthenticator struct {
+	linker *identityLinker
+}
+
+func NewLDAPAuthenticator(identities repository.IdentityRepository, userRepo repository.UserRepository, roles *RoleService, versions *TokenVersionStore) *LDAPAuthenticator {
+	return &LDAPAuthenticator{linker: &identityLinker{identities: identities, userRepo: userRepo, roles: roles, versions: versions}}
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return BackendLDAP
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, userName, password string) (*models.Users, error) {
+	// An empty password would be an unauthenticated bind, which many servers
+	// accept for any DN.
+	if userName == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	cfg := config.AppConfig.LDAP
+	conn, err := dialLDAP(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind failed: %w", err)
+		}
+	}
+	entry, err := findLDAPEntry(conn, &cfg, userName)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind failed: %w", err)
+	}
+
+	acct := externalAccount{
+		Provider:      BackendLDAP,
+		Subject:       ldapSubject(entry, cfg.IDAttribute),
+		UserName:      entry.GetAttributeValue(orDefaultString(cfg.UsernameAttribute, "uid")),
+		Email:         entry.GetAttributeValue(orDefaultString(cfg.EmailAttribute, "mail")),
+		EmailVerified: true, // the directory is authoritative
+		Role:          ldapRole(&cfg, entry.GetAttributeValues(orDefaultString(cfg.GroupAttribute, "memberOf"))),
+	}
+	if acct.UserName == "" {
+		acct.UserName = userName
+	}
+	return a.linker.link(ctx, acct)
+}
+
+func dialLDAP(cfg *config.LDAPConfig) (*ldap.Conn, error) {
+	timeout := time.Duration(orDefault(cfg.Timeout, 5)) * time.Second
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap: %w", err)
+	}
+	conn.SetTimeout(timeout)
+	if cfg.StartTLS {
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: cfg.InsecureSkipVerify}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findLDAPEntry returns the single entry matching the login name. No match
+// and ambiguous matches are both invalid credentials.
+func findLDAPEntry(conn *ldap.Conn, cfg *config.LDAPConfig, userName string) (*ldap.Entry, error) {
+	attributes := []string{
+		orDefaultString(cfg.UsernameAttribute, "uid"),
+		orDefaultString(cfg.EmailAttribute, "mail"),
+		orDefaultString(cfg.GroupAttribute, "memberOf"),
+	}
+	if cfg.IDAttribute != "" {
+		attributes = append(attributes, cfg.IDAttribute)
+	}
+	filter := fmt.Sprintf(orDefaultString(cfg.UserFilter, "(uid=%s)"), ldap.EscapeFilter(userName))
+	req := ldap.NewSearchRequest(cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, orDefault(cfg.Timeout, 5), false, filter, attributes, nil)
+	res, err := conn.Search(req)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap search failed: %w", err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return res.Entries[0], nil
+}
+
+// ldapSubject is the ID the entry is linked by. Binary IDs such as AD's
+// objectGUID are hex encoded.
+func ldapSubject(entry *ldap.Entry, idAttribute string) string {
+	if idAttribute == "" {
+		return entry.DN
+	}
+	if value := entry.GetAttributeValue(idAttribute); utf8.ValidString(value) && value != "" {
+		return value
+	}
+	return hex.EncodeToString(entry.GetRawAttributeValue(idAttribute))
+}
+
+// ldapRole returns the role of the first configured group the user is a
+// member of. DNs are compared the way LDAP does, ignoring case and spacing.
+func ldapRole(cfg *config.LDAPConfig, groups []string) string {
+	for _, mapping := range cfg.GroupRoles {
+		want, err := ldap.ParseDN(mapping.Group)
+		if err != nil {
+			continue
+		}
+		for _, group := range groups {
+			if dn, err := ldap.ParseDN(group); err == nil && dn.EqualFold(want) {
+				return mapping.Role
+			}
+		}
+	}
+	if cfg.DefaultRole != "" {
+		return cfg.DefaultRole
+	}
+	return string(models.RoleUser)
+}
+
+func orDefaultString(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
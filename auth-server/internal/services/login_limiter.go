@@ -0,0 +1,241 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lockoutMemory is how long past lockouts count towards the next lockout's
+// length.
+const lockoutMemory = 24 * time.Hour
+
+// LockedError is returned while a username or client IP is throttled.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %d seconds", e.RetrySeconds())
+}
+
+func (e *LockedError) RetrySeconds() int {
+	secs := int((e.RetryAfter + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// LoginLimiter tracks failed logins per username and per client IP in Redis
+// sliding windows. Each failure on a username adds an exponentially growing
+// delay before the next attempt; reaching the limit locks the username (or IP)
+// out, and every further lockout doubles in length up to the configured cap.
+type LoginLimiter struct {
+	userRepo repository.UserRepository
+	Redis    *redis.Client
+}
+
+func NewLoginLimiter(userRepo repository.UserRepository, Redis *redis.Client) *LoginLimiter {
+	return &LoginLimiter{userRepo: userRepo, Redis: Redis}
+}
+
+// Check returns a *LockedError if the username or IP may not try yet.
+func (l *LoginLimiter) Check(ctx context.Context, userName, ip string) error {
+	var wait time.Duration
+	for _, key := range []string{
+		limiterKey("login_locked", "user", userName),
+		limiterKey("login_backoff", "user", userName),
+		limiterKey("login_locked", "ip", ip),
+	} {
+		ttl, err := l.Redis.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+	if wait > 0 {
+		return &LockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// CheckUser enforces the persisted lock, which outlives Redis state.
+func (l *LoginLimiter) CheckUser(user *models.Users) error {
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return &LockedError{RetryAfter: time.Until(*user.LockedUntil)}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt. user may be nil when the username is
+// unknown; the username is throttled all the same so lockouts do not reveal
+// which accounts exist. A *LockedError is returned if this failure triggered
+// a lockout.
+func (l *LoginLimiter) RecordFailure(ctx context.Context, user *models.Users, userName, ip string) error {
+	cfg := config.AppConfig.LoginProtection
+
+	lock, failures, err := l.recordFailure(ctx, "user", userName, cfg.MaxAttempts)
+	if err != nil {
+		return err
+	}
+	if lock > 0 && user != nil {
+		lockedUntil := time.Now().Add(lock)
+		if err := l.userRepo.UpdateUser(ctx, user.ID, map[string]interface{}{"locked_until": lockedUntil}); err != nil {
+			return err
+		}
+	}
+	if lock == 0 && failures > 0 {
+		shift := failures - 1
+		if shift > 16 {
+			shift = 16
+		}
+		backoff := time.Second << shift
+		if max := time.Duration(cfg.Lockout) * time.Second; backoff > max {
+			backoff = max
+		}
+		if err := l.Redis.Set(ctx, limiterKey("login_backoff", "user", userName), 1, backoff).Err(); err != nil {
+			return err
+		}
+	}
+
+	ipLock, _, err := l.recordFailure(ctx, "ip", ip, cfg.IPMaxAttempts)
+	if err != nil {
+		return err
+	}
+	if ipLock > lock {
+		lock = ipLock
+	}
+	if lock > 0 {
+		return &LockedError{RetryAfter: lock}
+	}
+	return nil
+}
+
+// RecordSuccess forgets the failures of a username after a good login.
+func (l *LoginLimiter) RecordSuccess(ctx context.Context, userName string) error {
+	return l.Redis.Del(ctx,
+		limiterKey("login_failures", "user", userName),
+		limiterKey("login_backoff", "user", userName),
+		limiterKey("login_lockouts", "user", userName),
+	).Err()
+}
+
+// CheckTwoFactor returns a *LockedError while the user may not try another
+// 2FA code.
+func (l *LoginLimiter) CheckTwoFactor(ctx context.Context, user *models.Users) error {
+	ttl, err := l.Redis.PTTL(ctx, limiterKey("login_locked", "2fa", twoFactorSubject(user))).Result()
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return &LockedError{RetryAfter: ttl}
+	}
+	return nil
+}
+
+// RecordTwoFactorFailure counts a wrong 2FA code against the user, with the
+// same limits as wrong passwords. The count is kept apart from the password
+// failures, so a correct password, which resets those, does not reset it. A
+// *LockedError is returned if this failure triggered a lockout.
+func (l *LoginLimiter) RecordTwoFactorFailure(ctx context.Context, user *models.Users) error {
+	lock, _, err := l.recordFailure(ctx, "2fa", twoFactorSubject(user), config.AppConfig.LoginProtection.MaxAttempts)
+	if err != nil {
+		return err
+	}
+	if lock > 0 {
+		return &LockedError{RetryAfter: lock}
+	}
+	return nil
+}
+
+// RecordTwoFactorSuccess forgets the user's 2FA failures.
+func (l *LoginLimiter) RecordTwoFactorSuccess(ctx context.Context, user *models.Users) error {
+	return l.Redis.Del(ctx,
+		limiterKey("login_failures", "2fa", twoFactorSubject(user)),
+		limiterKey("login_lockouts", "2fa", twoFactorSubject(user)),
+	).Err()
+}
+
+// Unlock clears every lock on a user account.
+func (l *LoginLimiter) Unlock(ctx context.Context, user *models.Users) error {
+	if err := l.userRepo.UpdateUser(ctx, user.ID, map[string]interface{}{"locked_until": nil}); err != nil {
+		return err
+	}
+	return l.Redis.Del(ctx,
+		limiterKey("login_failures", "user", user.UserName),
+		limiterKey("login_backoff", "user", user.UserName),
+		limiterKey("login_lockouts", "user", user.UserName),
+		limiterKey("login_locked", "user", user.UserName),
+		limiterKey("login_failures", "2fa", twoFactorSubject(user)),
+		limiterKey("login_lockouts", "2fa", twoFactorSubject(user)),
+		limiterKey("login_locked", "2fa", twoFactorSubject(user)),
+	).Err()
+}
+
+// recordFailure adds a failure to the sliding window for one subject and
+// locks it out once max failures fall inside the window. It returns the
+// lockout duration (zero if not locked) and the failures counted so far.
+func (l *LoginLimiter) recordFailure(ctx context.Context, scope, subject string, max int) (time.Duration, int64, error) {
+	cfg := config.AppConfig.LoginProtection
+	window := time.Duration(cfg.Window) * time.Second
+	key := limiterKey("login_failures", scope, subject)
+	now := time.Now()
+
+	pipe := l.Redis.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.UnixNano()), Member: now.UnixNano()})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprint(now.Add(-window).UnixNano()))
+	count := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	failures := count.Val()
+	if max <= 0 || failures < int64(max) {
+		return 0, failures, nil
+	}
+
+	lockoutsKey := limiterKey("login_lockouts", scope, subject)
+	lockouts, err := l.Redis.Incr(ctx, lockoutsKey).Result()
+	if err != nil {
+		return 0, failures, err
+	}
+	l.Redis.Expire(ctx, lockoutsKey, lockoutMemory)
+
+	lock := time.Duration(cfg.Lockout) * time.Second
+	maxLock := time.Duration(cfg.MaxLockout) * time.Second
+	for i := int64(1); i < lockouts && lock < maxLock; i++ {
+		lock *= 2
+	}
+	if lock > maxLock {
+		lock = maxLock
+	}
+
+	pipe = l.Redis.TxPipeline()
+	pipe.Set(ctx, limiterKey("login_locked", scope, subject), 1, lock)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, failures, err
+	}
+	return lock, failures, nil
+}
+
+// twoFactorSubject keys 2FA failures by user ID, since the same user can log
+// in under other names through the directory backends.
+func twoFactorSubject(user *models.Users) string {
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+func limiterKey(prefix, scope, subject string) string {
+	return prefix + ":" + scope + ":" + strings.ToLower(subject)
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/mail"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// magicLinkThrottle is the minimum time between two magic link emails to the
+// same account.
+const magicLinkThrottle = time.Minute
+
+var (
+	ErrInvalidMagicLink = errors.New("invalid or expired login link")
+	ErrMagicLinkDevice  = errors.New("login link must be opened on the device that requested it")
+	ErrMagicLinkRole    = errors.New("login links are not available for your role")
+)
+
+// magicLink is stored in Redis under magic_link:<sha256(token)>.
+type magicLink struct {
+	UserID uint `json:"user_id"`
+	// DeviceHash is the hash of the device token handed to the requester.
+	DeviceHash string `json:"device_hash"`
+}
+
+// MagicLinkService implements passwordless login: a single-use link is
+// emailed to the user, and following it logs them in like a password would.
+// The link only works together with the device token returned to whoever
+// requested it, so a link that leaks from the mailbox, or is fetched by a
+// mail scanner, is of no use elsewhere. Only the most recent link of a user
+// is valid, and only users whose roles are all in config.MagicLink.Roles get
+// links, so an inbox is not enough to take over a privileged account.
+type MagicLinkService struct {
+	userRepo repository.UserRepository
+	auth     *AuthService
+	mailer   mail.Mailer
+	Redis    *redis.Client
+}
+
+func NewMagicLinkService(userRepo repository.UserRepository, auth *AuthService, mailer mail.Mailer, Redis *redis.Client) *MagicLinkService {
+	return &MagicLinkService{userRepo: userRepo, auth: auth, mailer: mailer, Redis: Redis}
+}
+
+// Request emails a login link if an account uses the address and returns the
+// device token to present with it. A device token is returned either way, so
+// the response does not tell whether the account exists.
+func (s *MagicLinkService) Request(ctx context.Context, email string) (string, error) {
+	deviceToken, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	email = NormalizeEmail(email)
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return deviceToken, nil
+	}
+	if err != nil {
+		return deviceToken, err
+	}
+	if allowed, err := s.allowed(ctx, user); err != nil || !allowed {
+		return deviceToken, err
+	}
+
+	ok, err := s.Redis.SetNX(ctx, magicLinkThrottleKey(user.ID), 1, magicLinkThrottle).Result()
+	if err != nil || !ok {
+		return deviceToken, err
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return deviceToken, err
+	}
+	hash := hashToken(token)
+	data, err := json.Marshal(magicLink{UserID: user.ID, DeviceHash: hashToken(deviceToken)})
+	if err != nil {
+		return deviceToken, err
+	}
+	ttl := magicLinkTTL()
+
+	// Replace the user's previous link, if any.
+	previous, err := s.Redis.GetSet(ctx, userMagicLinkKey(user.ID), hash).Result()
+	if err != nil && err != redis.Nil {
+		return deviceToken, err
+	}
+	pipe := s.Redis.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, magicLinkKey(previous))
+	}
+	pipe.Set(ctx, magicLinkKey(hash), data, ttl)
+	pipe.Expire(ctx, userMagicLinkKey(user.ID), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return deviceToken, err
+	}
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the link below to log in. It expires in %d minutes, can only be used once and only works on the device you asked for it from.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.UserName, int(ttl.Minutes()), magicLinkURL(token)),
+	}
+	go func() {
+		if err := s.mailer.Send(context.Background(), msg); err != nil {
+			log.Printf("failed to send login link email to user %d: %v", user.ID, err)
+		}
+	}()
+	return deviceToken, nil
+}
+
+// Verify consumes the link and logs the user in. A link opened without the
+// requesting device's token is refused but stays usable, so it can still be
+// opened on the right device. Locked accounts are refused as by Login, and
+// users with 2FA enabled get a challenge.
+func (s *MagicLinkService) Verify(ctx context.Context, token, deviceToken string, client dto.ClientInfo) (dto.LoginResponse, error) {
+	key := magicLinkKey(hashToken(token))
+	raw, err := s.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return dto.LoginResponse{}, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	var link magicLink
+	if err := json.Unmarshal([]byte(raw), &link); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if deviceToken == "" || subtle.ConstantTimeCompare([]byte(hashToken(deviceToken)), []byte(link.DeviceHash)) != 1 {
+		return dto.LoginResponse{}, ErrMagicLinkDevice
+	}
+
+	// Only one concurrent request gets to use the link.
+	if err := s.Redis.GetDel(ctx, key).Err(); err == redis.Nil {
+		return dto.LoginResponse{}, ErrInvalidMagicLink
+	} else if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	s.Redis.Del(ctx, userMagicLinkKey(link.UserID))
+
+	user, err := s.userRepo.GetUserByID(ctx, link.UserID)
+	if err != nil {
+		return dto.LoginResponse{}, ErrInvalidMagicLink
+	}
+	if err := s.auth.limiter.Check(ctx, user.UserName, client.IP); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if err := s.auth.limiter.CheckUser(user); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	// The role may have changed since the link was sent.
+	allowed, err := s.allowed(ctx, user)
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if !allowed {
+		return dto.LoginResponse{}, ErrMagicLinkRole
+	}
+	if err := s.auth.checkPasswordAllowed(ctx, user); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	return s.auth.completeLogin(ctx, user, client)
+}
+
+// allowed reports whether the user's primary role and every assigned role
+// may log in by link.
+func (s *MagicLinkService) allowed(ctx context.Context, user *models.Users) (bool, error) {
+	assigned, err := s.auth.roles.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	names := []string{user.Role}
+	for _, role := range assigned {
+		names = append(names, role.Name)
+	}
+	allowed := magicLinkRoles()
+	for _, name := range names {
+		if !slices.Contains(allowed, name) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func magicLinkRoles() []string {
+	if roles := config.AppConfig.MagicLink.Roles; len(roles) > 0 {
+		return roles
+	}
+	return []string{string(models.RoleUser)}
+}
+
+func magicLinkTTL() time.Duration {
+	if seconds := config.AppConfig.MagicLink.TokenExpiration; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 10 * time.Minute
+}
+
+func magicLinkURL(token string) string {
+	link, err := url.Parse(config.AppConfig.MagicLink.URL)
+	if err != nil {
+		return config.AppConfig.MagicLink.URL + "?token=" + url.QueryEscape(token)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+func magicLinkKey(hash string) string {
+	return "magic_link:" + hash
+}
+
+// userMagicLinkKey holds the hash of the user's current link.
+func userMagicLinkKey(userID uint) string {
+	return fmt.Sprintf("magic_link_user:%d", userID)
+}
+
+func magicLinkThrottleKey(userID uint) string {
+	return fmt.Sprintf("magic_link_throttle:%d", userID)
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// OAuthError is an error that maps onto an RFC 6749 error response.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+var ErrUnknownClient = errors.New("unknown client or redirect_uri")
+
+// authorizationCode is stored in Redis under oidc_code:<sha256(code)> until it
+// is redeemed at the token endpoint or expires.
+type authorizationCode struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	UserID        uint   `json:"user_id"`
+	Scope         string `json:"scope"`
+	Nonce         string `json:"nonce"`
+	CodeChallenge string `json:"code_challenge"`
+	AuthTime      int64  `json:"auth_time"`
+	// The browser the user signed in from, recorded on the session.
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+type IDTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	PreferredUsername string `json:"preferred_username"`
+	Role              string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+type OIDCService struct {
+	clientRepo repository.OAuthClientRepository
+	userRepo   repository.UserRepository
+	auth       *AuthService
+}
+
+func NewOIDCService(clientRepo repository.OAuthClientRepository, userRepo repository.UserRepository, auth *AuthService) *OIDCService {
+	return &OIDCService{clientRepo: clientRepo, userRepo: userRepo, auth: auth}
+}
+
+func (s *OIDCService) Issuer() string {
+	return strings.TrimRight(config.AppConfig.OIDC.Issuer, "/")
+}
+
+func (s *OIDCService) Discovery() dto.DiscoveryDocument {
+	issuer := s.Issuer()
+	return dto.DiscoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device/code",
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  s.auth.Keys.Algorithms(),
+		ScopesSupported:                   []string{"openid", "profile"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", DeviceCodeGrantType},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "role"},
+	}
+}
+
+// LookupClient resolves the client of an authorization request. Errors from
+// here must be shown to the user rather than redirected, since the redirect
+// URI itself cannot be trusted yet.
+func (s *OIDCService) LookupClient(ctx context.Context, clientID, redirectURI string) (*models.OAuthClient, error) {
+	client, err := s.clientRepo.GetClientByClientID(ctx, clientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsRedirect(redirectURI) {
+		return nil, ErrUnknownClient
+	}
+	return client, nil
+}
+
+// ValidateAuthorizeRequest checks the parameters that are reported back to
+// the client through its redirect URI.
+func (s *OIDCService) ValidateAuthorizeRequest(req *dto.AuthorizeRequest) *OAuthError {
+	if req.ResponseType != "code" {
+		return oauthError("unsupported_response_type", "only the authorization code flow is supported")
+	}
+	if !hasScope(req.Scope, "openid") {
+		return oauthError("invalid_scope", "the openid scope is required")
+	}
+	if req.CodeChallenge == "" {
+		return oauthError("invalid_request", "code_challenge is required")
+	}
+	if req.CodeChallengeMethod != "S256" {
+		return oauthError("invalid_request", "code_challenge_method must be S256")
+	}
+	return nil
+}
+
+// Authenticate checks the credentials entered on the authorization page,
+// including the 2FA code for users that have it enabled.
+func (s *OIDCService) Authenticate(ctx context.Context, userName, password, otp string, client dto.ClientInfo) (*models.Users, error) {
+	user, err := s.auth.authenticate(ctx, userName, password, client)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		if err := s.auth.twoFactor.Verify(ctx, user, otp); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// IssueCode creates a single-use authorization code for an authenticated user.
+func (s *OIDCService) IssueCode(ctx context.Context, req *dto.AuthorizeRequest, user *models.Users, client dto.ClientInfo) (string, error) {
+	code, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(authorizationCode{
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		UserID:        user.ID,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      time.Now().Unix(),
+		IP:            client.IP,
+		UserAgent:     client.UserAgent,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ttl := time.Second * time.Duration(config.AppConfig.OIDC.CodeExpiration)
+	if err := s.auth.Redis.Set(ctx, "oidc_code:"+hashToken(code), data, ttl).Err(); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// AuthenticateClient authenticates a client at the token endpoint. Public
+// clients identify themselves with client_id alone.
+func (s *OIDCService) AuthenticateClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	client, err := s.clientRepo.GetClientByClientID(ctx, clientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.IsPublic() {
+		if clientSecret != "" {
+			return nil, oauthError("invalid_client", "public clients must not send a secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(client.HashedSecret)) != 1 {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+// Token handles the grants supported by the token endpoint for an already
+// authenticated client.
+func (s *OIDCService) Token(ctx context.Context, client *models.OAuthClient, req *dto.TokenRequest) (dto.TokenResponse, error) {
+	switch req.GrantType {
+	case "authorization_code":
+		return s.exchangeCode(ctx, client, req)
+	case DeviceCodeGrantType:
+		return s.exchangeDeviceCode(ctx, client, req)
+	case "refresh_token":
+		tokens, err := s.auth.RefreshForClient(ctx, req.RefreshToken, client.ClientID)
+		if err != nil {
+			return dto.TokenResponse{}, oauthError("invalid_grant", err.Error())
+		}
+		return bearerResponse(tokens), nil
+	default:
+		return dto.TokenResponse{}, oauthError("unsupported_grant_type", fmt.Sprintf("grant type %q is not supported", req.GrantType))
+	}
+}
+
+func (s *OIDCService) exchangeCode(ctx context.Context, client *models.OAuthClient, req *dto.TokenRequest) (dto.TokenResponse, error) {
+	key := "oidc_code:" + hashToken(req.Code)
+	raw, err := s.auth.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return dto.TokenResponse{}, oauthError("invalid_grant", "invalid or expired authorization code")
+	}
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	var code authorizationCode
+	if err := json.Unmarshal([]byte(raw), &code); err != nil {
+		return dto.TokenResponse{}, err
+	}
+	// Checked before redeeming the code, so that another client presenting
+	// it cannot burn it for the one it was issued to.
+	if code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return dto.TokenResponse{}, oauthError("invalid_grant", "authorization code was issued to another client or redirect_uri")
+	}
+	// GETDEL redeems the code atomically, so it cannot be used twice.
+	err = s.auth.Redis.GetDel(ctx, key).Err()
+	if err == redis.Nil {
+		return dto.TokenResponse{}, oauthError("invalid_grant", "invalid or expired authorization code")
+	}
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	if !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return dto.TokenResponse{}, oauthError("invalid_grant", "code_verifier does not match code_challenge")
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, code.UserID)
+	if err != nil {
+		return dto.TokenResponse{}, oauthError("invalid_grant", "user no longer exists")
+	}
+
+	tokens, err := s.auth.startClientSession(ctx, user, client.ClientID, dto.ClientInfo{IP: code.IP, UserAgent: code.UserAgent})
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	now := time.Now()
+	idToken, err := s.auth.Keys.Sign(IDTokenClaims{
+		Nonce:             code.Nonce,
+		AuthTime:          code.AuthTime,
+		PreferredUsername: user.UserName,
+		Role:              user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Issuer(),
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTTL())),
+		},
+	})
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+
+	resp := bearerResponse(tokens)
+	resp.IDToken = idToken
+	resp.Scope = code.Scope
+	return resp, nil
+}
+
+func (s *OIDCService) UserInfo(ctx context.Context, userID uint) (dto.UserInfoResponse, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return dto.UserInfoResponse{}, err
+	}
+	return dto.UserInfoResponse{
+		Sub:               strconv.FormatUint(uint64(user.ID), 10),
+		PreferredUsername: user.UserName,
+		Role:              user.Role,
+	}, nil
+}
+
+func (s *OIDCService) GetAllClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	return s.clientRepo.GetAllClients(ctx)
+}
+
+// CreateClient registers a client. The generated secret is returned once and
+// only its hash is stored.
+func (s *OIDCService) CreateClient(ctx context.Context, req *dto.CreateOAuthClientRequest) (*models.OAuthClient, string, error) {
+	if len(req.RedirectURIs) == 0 {
+		return nil, "", errors.New("at least one redirect URI is required")
+	}
+	for _, uri := range req.RedirectURIs {
+		if uri == "" || strings.ContainsAny(uri, " \t\n") {
+			return nil, "", fmt.Errorf("invalid redirect URI %q", uri)
+		}
+	}
+
+	clientID, err := generateRandomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &models.OAuthClient{
+		ClientID:     clientID,
+		Name:         req.Name,
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+	}
+
+	var secret string
+	if !req.Public {
+		secret, err = generateRandomToken(32)
+		if err != nil {
+			return nil, "", err
+		}
+		client.HashedSecret = hashToken(secret)
+	}
+
+	if err := s.clientRepo.CreateClient(ctx, client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+func (s *OIDCService) DeleteClient(ctx context.Context, id uint) error {
+	return s.clientRepo.DeleteClient(ctx, id)
+}
+
+func bearerResponse(tokens dto.LoginResponse) dto.TokenResponse {
+	return dto.TokenResponse{
+		AccessToken:  tokens.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    config.AppConfig.JWT.Expiration * 60,
+		RefreshToken: tokens.RefreshToken,
+	}
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	if verifier == "" || challenge == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords into self-describing strings: PHC format for
+// Argon2id, the usual $2a$ format for bcrypt.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify fails with ErrUnknownHashFormat if hash was not made by this
+	// hasher's algorithm.
+	Verify(hash, password string) (bool, error)
+	// NeedsRehash reports whether hash uses a different algorithm or weaker
+	// parameters than this hasher would.
+	NeedsRehash(hash string) bool
+}
+
+// Argon2idHasher writes $argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(hash, password string) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.Memory || params.Iterations < h.Iterations || params.Parallelism < h.Parallelism ||
+		uint32(len(salt)) < h.SaltLength || uint32(len(key)) < h.KeyLength
+}
+
+func parseArgon2id(hash string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgArgon2id {
+		return nil, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	params := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 key: %w", err)
+	}
+	return params, salt, key, nil
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h *BcryptHasher) Verify(hash, password string) (bool, error) {
+	if !isBcryptHash(hash) {
+		return false, ErrUnknownHashFormat
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.Cost
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// passwordHasher returns the hasher for config.AppConfig.PasswordHashing,
+// falling back to Argon2id with the defaults below for unset values.
+func passwordHasher() PasswordHasher {
+	cfg := config.PasswordHashingConfig{}
+	if config.AppConfig != nil {
+		cfg = config.AppConfig.PasswordHashing
+	}
+	if cfg.Algorithm == AlgBcrypt {
+		return &BcryptHasher{Cost: orDefault(cfg.BcryptCost, bcrypt.DefaultCost)}
+	}
+	return &Argon2idHasher{
+		Memory:      uint32(orDefault(cfg.Argon2.Memory, 64*1024)),
+		Iterations:  uint32(orDefault(cfg.Argon2.Iterations, 3)),
+		Parallelism: uint8(orDefault(cfg.Argon2.Parallelism, 2)),
+		SaltLength:  uint32(orDefault(cfg.Argon2.SaltLength, 16)),
+		KeyLength:   uint32(orDefault(cfg.Argon2.KeyLength, 32)),
+	}
+}
+
+// hasherFor picks the hasher that can verify hash. Verification reads the
+// parameters from the hash itself, so the configured ones do not matter.
+func hasherFor(hash string) PasswordHasher {
+	if isBcryptHash(hash) {
+		return &BcryptHasher{}
+	}
+	return &Argon2idHasher{}
+}
+
+func orDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"auth-server/internal/breach"
+	"auth-server/internal/config"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PolicyViolation names one password rule that was not met.
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a rejected password failed.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return "password does not meet the policy: " + strings.Join(rules, ", ")
+}
+
+// PasswordPolicy enforces config.PasswordPolicyConfig whenever a password is
+// set, and keeps the password history used by the reuse check.
+type PasswordPolicy struct {
+	history  repository.PasswordHistoryRepository
+	breached breach.Checker
+}
+
+func NewPasswordPolicy(history repository.PasswordHistoryRepository, breached breach.Checker) *PasswordPolicy {
+	return &PasswordPolicy{history: history, breached: breached}
+}
+
+// Validate checks password for user. user.ID is zero for a user that does not
+// exist yet, in which case the history check is skipped.
+func (p *PasswordPolicy) Validate(ctx context.Context, user *models.Users, password string) error {
+	cfg := config.AppConfig.PasswordPolicy
+	var violations []PolicyViolation
+	add := func(rule, format string, args ...interface{}) {
+		violations = append(violations, PolicyViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if utf8.RuneCountInString(password) < cfg.MinLength {
+		add("min_length", "must be at least %d characters long", cfg.MinLength)
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if cfg.RequireUpper && !upper {
+		add("uppercase", "must contain an uppercase letter")
+	}
+	if cfg.RequireLower && !lower {
+		add("lowercase", "must contain a lowercase letter")
+	}
+	if cfg.RequireDigit && !digit {
+		add("digit", "must contain a digit")
+	}
+	if cfg.RequireSymbol && !symbol {
+		add("symbol", "must contain a symbol")
+	}
+	if cfg.DisallowUsername && user.UserName != "" &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(user.UserName)) {
+		add("contains_username", "must not contain the username")
+	}
+
+	if cfg.HistorySize > 0 && user.ID != 0 {
+		reused, err := p.isReused(ctx, user, password, cfg.HistorySize)
+		if err != nil {
+			return err
+		}
+		if reused {
+			add("reused", "must not be one of the last %d passwords", cfg.HistorySize)
+		}
+	}
+	if cfg.CheckBreached {
+		breached, err := p.breached.IsBreached(ctx, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			add("breached", "appears in a list of breached passwords")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// Record adds a newly set password hash to the user's history.
+func (p *PasswordPolicy) Record(ctx context.Context, userID uint, hashedPassword string) error {
+	keep := config.AppConfig.PasswordPolicy.HistorySize
+	if keep <= 0 {
+		return nil
+	}
+	return p.history.Add(ctx, &models.PasswordHistory{UserID: userID, HashedPassword: hashedPassword}, keep)
+}
+
+// isReused compares against the current password too, since users created
+// before the history existed have no entries yet.
+func (p *PasswordPolicy) isReused(ctx context.Context, user *models.Users, password string, size int) (bool, error) {
+	if user.HashedPassword != "" && CheckPassword(user.HashedPassword, password) {
+		return true, nil
+	}
+	entries, err := p.history.GetRecent(ctx, user.ID, size)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if CheckPassword(e.HashedPassword, password) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
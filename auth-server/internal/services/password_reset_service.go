@@ -0,0 +1,176 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/mail"
+	"auth-server/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// passwordResetThrottle is the minimum time between two reset emails to the
+// same account.
+const passwordResetThrottle = time.Minute
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrExternalAccount   = errors.New("the password of this account is managed by its identity provider")
+)
+
+// PasswordResetService implements forgot-password: a single-use token is
+// emailed to the user and stored hashed in Redis under password_reset:<hash>.
+// Only the most recent token of a user is valid. Users linked to an LDAP
+// directory or a federated provider cannot reset a local password, since
+// that would let them log in without the external account.
+type PasswordResetService struct {
+	userRepo   repository.UserRepository
+	identities repository.IdentityRepository
+	users      *UserService
+	mailer     mail.Mailer
+	Redis      *redis.Client
+}
+
+func NewPasswordResetService(userRepo repository.UserRepository, identities repository.IdentityRepository, users *UserService, mailer mail.Mailer, Redis *redis.Client) *PasswordResetService {
+	return &PasswordResetService{userRepo: userRepo, identities: identities, users: users, mailer: mailer, Redis: Redis}
+}
+
+// Forgot emails a reset link if a local account uses the address. It does
+// not report whether one exists, and the email is sent in the background so
+// the response time does not give it away either.
+func (s *PasswordResetService) Forgot(ctx context.Context, email string) error {
+	email = NormalizeEmail(email)
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	external, err := s.identities.HasIdentity(ctx, user.ID)
+	if err != nil || external {
+		return err
+	}
+
+	ok, err := s.Redis.SetNX(ctx, resetThrottleKey(user.ID), 1, passwordResetThrottle).Result()
+	if err != nil || !ok {
+		return err
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	hash := hashToken(token)
+	ttl := resetTTL()
+
+	// Replace the user's previous token, if any.
+	previous, err := s.Redis.GetSet(ctx, userResetKey(user.ID), hash).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	pipe := s.Redis.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, resetKey(previous))
+	}
+	pipe.Set(ctx, resetKey(hash), user.ID, ttl)
+	pipe.Expire(ctx, userResetKey(user.ID), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.UserName, int(ttl.Minutes()), resetLink(token)),
+	}
+	go func() {
+		if err := s.mailer.Send(context.Background(), msg); err != nil {
+			log.Printf("failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// Reset checks the new password against the password policy, then consumes
+// the token and sets it. Like an admin password change, this invalidates the
+// user's tokens and ends every session; it also lifts any login lockout. A
+// password rejected by the policy leaves the token usable for another try.
+func (s *PasswordResetService) Reset(ctx context.Context, token, password string) error {
+	key := resetKey(hashToken(token))
+	raw, err := s.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	userID, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	user, err := s.userRepo.GetUserByID(ctx, uint(userID))
+	if err != nil {
+		return err
+	}
+	// The account may have been linked since the token was sent.
+	external, err := s.identities.HasIdentity(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if external {
+		return ErrExternalAccount
+	}
+	if err := s.users.ValidatePassword(ctx, user, password); err != nil {
+		return err
+	}
+
+	// Only one concurrent request gets to use the token.
+	if err := s.Redis.GetDel(ctx, key).Err(); err == redis.Nil {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return err
+	}
+	s.Redis.Del(ctx, userResetKey(user.ID))
+
+	if err := s.users.setPassword(ctx, user.ID, password); err != nil {
+		return err
+	}
+	return s.users.UnlockUser(ctx, user.ID)
+}
+
+func resetTTL() time.Duration {
+	return time.Duration(config.AppConfig.PasswordReset.TokenExpiration) * time.Second
+}
+
+func resetLink(token string) string {
+	link, err := url.Parse(config.AppConfig.PasswordReset.URL)
+	if err != nil {
+		return config.AppConfig.PasswordReset.URL + "?token=" + url.QueryEscape(token)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+func resetKey(hash string) string {
+	return "password_reset:" + hash
+}
+
+// userResetKey holds the hash of the user's current reset token.
+func userResetKey(userID uint) string {
+	return fmt.Sprintf("password_reset_user:%d", userID)
+}
+
+func resetThrottleKey(userID uint) string {
+	return fmt.Sprintf("password_reset_throttle:%d", userID)
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var permissionNamePattern = regexp.MustCompile(`^[a-z0-9_-]+:([a-z0-9_-]+|\*)$`)
+
+var (
+	ErrUnknownRole        = errors.New("unknown role")
+	ErrUnknownPermission  = errors.New("unknown permission")
+	ErrRoleInUse          = errors.New("role is still the primary role of some users")
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrPermissionNotFound = errors.New("permission not found")
+)
+
+// RoleService manages roles, permissions and their assignment to users. Any
+// change that alters a user's effective permissions bumps their token
+// version, since permissions are embedded in access tokens.
+type RoleService struct {
+	roleRepo repository.RoleRepository
+	versions *TokenVersionStore
+}
+
+func NewRoleService(roleRepo repository.RoleRepository, versions *TokenVersionStore) *RoleService {
+	return &RoleService{roleRepo: roleRepo, versions: versions}
+}
+
+func (s *RoleService) GetAllRoles(ctx context.Context) ([]*models.Roles, error) {
+	return s.roleRepo.GetAllRoles(ctx)
+}
+
+func (s *RoleService) CreateRole(ctx context.Context, req *dto.CreateRoleRequest) (*models.Roles, error) {
+	permissions, err := s.lookupPermissions(ctx, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	role := &models.Roles{
+		Name:           strings.TrimSpace(req.Name),
+		Description:    req.Description,
+		RequirePasskey: req.RequirePasskey,
+		Permissions:    permissions,
+	}
+	if role.Name == "" {
+		return nil, errors.New("role name is required")
+	}
+	if err := s.roleRepo.CreateRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *RoleService) UpdateRole(ctx context.Context, id uint, req *dto.UpdateRoleRequest) (*models.Roles, error) {
+	role, err := s.getRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := s.lookupPermissions(ctx, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Description = req.Description
+	role.RequirePasskey = req.RequirePasskey
+	if err := s.roleRepo.UpdateRole(ctx, role, permissions); err != nil {
+		return nil, err
+	}
+	role.Permissions = permissions
+	return role, s.bumpRoleMembers(ctx, role)
+}
+
+func (s *RoleService) DeleteRole(ctx context.Context, id uint) error {
+	role, err := s.getRole(ctx, id)
+	if err != nil {
+		return err
+	}
+	count, err := s.roleRepo.CountUsersWithPrimaryRole(ctx, role.Name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+
+	userIDs, err := s.roleRepo.GetUserIDsWithRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	if err := s.roleRepo.DeleteRole(ctx, role); err != nil {
+		return err
+	}
+	return s.bumpUsers(ctx, userIDs)
+}
+
+func (s *RoleService) GetAllPermissions(ctx context.Context) ([]*models.Permissions, error) {
+	return s.roleRepo.GetAllPermissions(ctx)
+}
+
+func (s *RoleService) CreatePermission(ctx context.Context, req *dto.CreatePermissionRequest) (*models.Permissions, error) {
+	name := strings.TrimSpace(req.Name)
+	if !permissionNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid permission name %q, expected resource:action", name)
+	}
+	permission := &models.Permissions{Name: name, Description: req.Description}
+	if err := s.roleRepo.CreatePermission(ctx, permission); err != nil {
+		return nil, err
+	}
+	return permission, nil
+}
+
+func (s *RoleService) DeletePermission(ctx context.Context, id uint) error {
+	permission, err := s.roleRepo.GetPermissionByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrPermissionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	roles, err := s.roleRepo.GetRolesWithPermission(ctx, permission.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.roleRepo.DeletePermission(ctx, permission); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err := s.bumpRoleMembers(ctx, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RoleExists reports whether name can be used as a user's role.
+func (s *RoleService) RoleExists(ctx context.Context, name string) (bool, error) {
+	roles, err := s.roleRepo.GetRolesByNames(ctx, []string{name})
+	if err != nil {
+		return false, err
+	}
+	return len(roles) > 0, nil
+}
+
+// RequiresPasskey reports whether the user's primary role or any assigned
+// role requires passkey sign-in.
+func (s *RoleService) RequiresPasskey(ctx context.Context, user *models.Users) (bool, error) {
+	primary, err := s.roleRepo.GetRolesByNames(ctx, []string{user.Role})
+	if err != nil {
+		return false, err
+	}
+	assigned, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range append(primary, assigned...) {
+		if role.RequirePasskey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *RoleService) GetUserRoles(ctx context.Context, userID uint) ([]*models.Roles, error) {
+	return s.roleRepo.GetUserRoles(ctx, userID)
+}
+
+// SetUserRoles replaces the roles assigned to a user in addition to their
+// primary role.
+func (s *RoleService) SetUserRoles(ctx context.Context, userID uint, names []string) error {
+	roles := []*models.Roles{}
+	if len(names) > 0 {
+		var err error
+		roles, err = s.roleRepo.GetRolesByNames(ctx, names)
+		if err != nil {
+			return err
+		}
+		if missing := missingNames(names, roleNames(roles)); len(missing) > 0 {
+			return fmt.Errorf("%w: %s", ErrUnknownRole, strings.Join(missing, ", "))
+		}
+	}
+	if err := s.roleRepo.SetUserRoles(ctx, userID, roles); err != nil {
+		return err
+	}
+	return s.versions.Bump(ctx, userID)
+}
+
+// PermissionsForUser resolves the user's effective permissions.
+func (s *RoleService) PermissionsForUser(ctx context.Context, userID uint) ([]string, error) {
+	return s.roleRepo.GetUserPermissions(ctx, userID)
+}
+
+func (s *RoleService) getRole(ctx context.Context, id uint) (*models.Roles, error) {
+	role, err := s.roleRepo.GetRoleByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotFound
+	}
+	return role, err
+}
+
+func (s *RoleService) lookupPermissions(ctx context.Context, names []string) ([]*models.Permissions, error) {
+	if len(names) == 0 {
+		return []*models.Permissions{}, nil
+	}
+	permissions, err := s.roleRepo.GetPermissionsByNames(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		found = append(found, p.Name)
+	}
+	if missing := missingNames(names, found); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, strings.Join(missing, ", "))
+	}
+	return permissions, nil
+}
+
+func (s *RoleService) bumpRoleMembers(ctx context.Context, role *models.Roles) error {
+	userIDs, err := s.roleRepo.GetUserIDsWithRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	return s.bumpUsers(ctx, userIDs)
+}
+
+func (s *RoleService) bumpUsers(ctx context.Context, userIDs []uint) error {
+	for _, id := range userIDs {
+		if err := s.versions.Bump(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasPermission reports whether granted includes perm, honouring the "*" and
+// "resource:*" wildcards.
+func HasPermission(granted []string, perm string) bool {
+	resource, _, _ := strings.Cut(perm, ":")
+	for _, g := range granted {
+		if g == perm || g == models.PermissionAll || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAllPermissions reports whether granted covers every permission in
+// required, so that acting with required grants nothing beyond granted.
+func HasAllPermissions(granted, required []string) bool {
+	for _, perm := range required {
+		if !HasPermission(granted, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+func roleNames(roles []*models.Roles) []string {
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func missingNames(wanted, found []string) []string {
+	have := map[string]bool{}
+	for _, name := range found {
+		have[name] = true
+	}
+	var missing []string
+	for _, name := range wanted {
+		if !have[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
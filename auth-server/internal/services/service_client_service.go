@@ -0,0 +1,172 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/keys"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// ClientClaims are the claims of tokens issued by the client_credentials
+// grant. Subject is the client ID; there is no user or session behind them.
+type ClientClaims struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+func (c *ClientClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// ServiceClientService issues and verifies tokens for service-to-service
+// calls.
+type ServiceClientService struct {
+	repo     repository.ServiceClientRepository
+	denylist *TokenDenylist
+	Keys     *keys.KeySet
+}
+
+func NewServiceClientService(repo repository.ServiceClientRepository, denylist *TokenDenylist, keySet *keys.KeySet) *ServiceClientService {
+	return &ServiceClientService{repo: repo, denylist: denylist, Keys: keySet}
+}
+
+// Authenticate checks the client's secret. Errors are OAuthErrors so the
+// token endpoint can return them as they are.
+func (s *ServiceClientService) Authenticate(ctx context.Context, clientID, clientSecret string) (*models.ServiceClient, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	client, err := s.repo.GetClientByClientID(ctx, clientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(client.HashedSecret)) != 1 {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+// IssueToken handles the client_credentials grant. An empty scope requests
+// every scope the client is allowed.
+func (s *ServiceClientService) IssueToken(ctx context.Context, client *models.ServiceClient, scope string) (dto.TokenResponse, error) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.ScopeList()
+	}
+	for _, sc := range scopes {
+		if !client.AllowsScope(sc) {
+			return dto.TokenResponse{}, oauthError("invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", sc))
+		}
+	}
+
+	jti, err := generateRandomToken(16)
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	now := time.Now()
+	granted := strings.Join(scopes, " ")
+	token, err := s.Keys.Sign(ClientClaims{
+		ClientID: client.ClientID,
+		Scope:    granted,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    strings.TrimRight(config.AppConfig.OIDC.Issuer, "/"),
+			Subject:   client.ClientID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(clientTokenTTL())),
+		},
+	})
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	return dto.TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(clientTokenTTL().Seconds()),
+		Scope:       granted,
+	}, nil
+}
+
+// VerifyToken checks a token issued by IssueToken.
+func (s *ServiceClientService) VerifyToken(ctx context.Context, tokenStr string) (*ClientClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &ClientClaims{}, s.Keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	claims := token.Claims.(*ClientClaims)
+	if claims.ClientID == "" || claims.Subject != claims.ClientID {
+		return nil, ErrInvalidToken
+	}
+	revoked, err := s.denylist.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *ServiceClientService) GetAllClients(ctx context.Context) ([]*models.ServiceClient, error) {
+	return s.repo.GetAllClients(ctx)
+}
+
+// CreateClient registers a service client. The generated secret is returned
+// once and only its hash is stored.
+func (s *ServiceClientService) CreateClient(ctx context.Context, req *dto.CreateServiceClientRequest) (*models.ServiceClient, string, error) {
+	for _, sc := range req.Scopes {
+		if sc == "" || strings.ContainsAny(sc, " \t\n") {
+			return nil, "", fmt.Errorf("invalid scope %q", sc)
+		}
+	}
+	clientID, err := generateRandomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := generateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &models.ServiceClient{
+		ClientID:     clientID,
+		Name:         req.Name,
+		HashedSecret: hashToken(secret),
+		Scopes:       strings.Join(req.Scopes, " "),
+	}
+	if err := s.repo.CreateClient(ctx, client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+func (s *ServiceClientService) DeleteClient(ctx context.Context, id uint) error {
+	return s.repo.DeleteClient(ctx, id)
+}
+
+// HasScope reports whether granted includes scope.
+func HasScope(granted []string, scope string) bool {
+	for _, g := range granted {
+		if g == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func clientTokenTTL() time.Duration {
+	return time.Duration(config.AppConfig.ClientCredentials.TokenExpiration) * time.Second
+}
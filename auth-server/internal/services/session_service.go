@@ -0,0 +1,206 @@
+package services
+
+import (
+	"auth-server/internal/dto"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lastSeenResolution limits how often a session's last-seen time is written.
+const lastSeenResolution = time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is one login of a user. It lives in Redis under session:<id> and
+// owns the refresh-token family rotated through /api/refresh.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     uint      `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// ImpersonatorID is the admin acting as the user in this session, if any.
+	ImpersonatorID uint `json:"impersonator_id,omitempty"`
+	// ClientID is the OAuth client the session's tokens were issued to; empty
+	// for first-party logins.
+	ClientID string `json:"client_id,omitempty"`
+}
+
+type SessionService struct {
+	Redis *redis.Client
+}
+
+func NewSessionService(Redis *redis.Client) *SessionService {
+	return &SessionService{Redis: Redis}
+}
+
+func (s *SessionService) Create(ctx context.Context, userID uint, client dto.ClientInfo, ttl time.Duration) (*Session, error) {
+	return s.create(ctx, &Session{UserID: userID}, client, ttl)
+}
+
+// CreateForClient starts a session whose tokens are issued to the OAuth
+// client clientID; only that client can refresh them.
+func (s *SessionService) CreateForClient(ctx context.Context, userID uint, clientID string, client dto.ClientInfo, ttl time.Duration) (*Session, error) {
+	return s.create(ctx, &Session{UserID: userID, ClientID: clientID}, client, ttl)
+}
+
+// CreateImpersonation starts a session in which actorID acts as userID.
+func (s *SessionService) CreateImpersonation(ctx context.Context, userID, actorID uint, client dto.ClientInfo, ttl time.Duration) (*Session, error) {
+	return s.create(ctx, &Session{UserID: userID, ImpersonatorID: actorID}, client, ttl)
+}
+
+func (s *SessionService) create(ctx context.Context, sess *Session, client dto.ClientInfo, ttl time.Duration) (*Session, error) {
+	id, err := generateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sess.ID = id
+	sess.UserAgent = client.UserAgent
+	sess.IP = client.IP
+	sess.CreatedAt = now
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(ttl)
+	if err := s.save(ctx, sess, ttl); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (s *SessionService) Get(ctx context.Context, id string) (*Session, error) {
+	raw, err := s.Redis.Get(ctx, sessionKey(id)).Result()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sess Session
+	if err := json.Unmarshal([]byte(raw), &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// Extend pushes the expiry out again; called whenever the session's refresh
+// token is rotated.
+func (s *SessionService) Extend(ctx context.Context, sess *Session, ttl time.Duration) error {
+	now := time.Now()
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(ttl)
+	return s.save(ctx, sess, ttl)
+}
+
+// Touch records activity on the session, at most once per lastSeenResolution.
+func (s *SessionService) Touch(ctx context.Context, sess *Session) error {
+	if time.Since(sess.LastSeenAt) < lastSeenResolution {
+		return nil
+	}
+	sess.LastSeenAt = time.Now()
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	// XX so a concurrent revoke is not undone by this write.
+	return s.Redis.SetArgs(ctx, sessionKey(sess.ID), data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+}
+
+// List returns the live sessions of a user, pruning ones that have expired.
+func (s *SessionService) List(ctx context.Context, userID uint) ([]*Session, error) {
+	ids, err := s.Redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*Session{}
+	for _, id := range ids {
+		sess, err := s.Get(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			s.Redis.SRem(ctx, userSessionsKey(userID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+// Revoke ends a session together with every refresh token issued in it.
+func (s *SessionService) Revoke(ctx context.Context, id string) error {
+	sess, err := s.Get(ctx, id)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+
+	refreshKeys, err := s.Redis.SMembers(ctx, sessionRefreshKey(id)).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.Redis.TxPipeline()
+	pipe.Del(ctx, append(refreshKeys, sessionKey(id), sessionRefreshKey(id))...)
+	if sess != nil {
+		pipe.SRem(ctx, userSessionsKey(sess.UserID), id)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeAllForUser ends every session of a user except keepID, if given.
+func (s *SessionService) RevokeAllForUser(ctx context.Context, userID uint, keepID string) error {
+	ids, err := s.Redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == keepID {
+			continue
+		}
+		if err := s.Revoke(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionService) save(ctx context.Context, sess *Session, ttl time.Duration) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	// The user's session set has to outlive their other sessions, so a short
+	// one, like an impersonation, must not shorten it.
+	setTTL := ttl
+	if setTTL < refreshTTL() {
+		setTTL = refreshTTL()
+	}
+	pipe := s.Redis.TxPipeline()
+	pipe.Set(ctx, sessionKey(sess.ID), data, ttl)
+	pipe.SAdd(ctx, userSessionsKey(sess.UserID), sess.ID)
+	pipe.Expire(ctx, userSessionsKey(sess.UserID), setTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+// sessionRefreshKey holds the Redis keys of every refresh token issued in a
+// session, so they can be deleted when the session is revoked.
+func sessionRefreshKey(id string) string {
+	return "session_refresh:" + id
+}
+
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
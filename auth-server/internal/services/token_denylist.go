@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TokenDenylist records revoked JWTs by jti until they would have expired
+// anyway, under revoked_jti:<jti>.
+type TokenDenylist struct {
+	Redis *redis.Client
+}
+
+func NewTokenDenylist(Redis *redis.Client) *TokenDenylist {
+	return &TokenDenylist{Redis: Redis}
+}
+
+func (d *TokenDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return d.Redis.Set(ctx, revokedJTIKey(jti), 1, ttl).Err()
+}
+
+func (d *TokenDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+	n, err := d.Redis.Exists(ctx, revokedJTIKey(jti)).Result()
+	return n > 0, err
+}
+
+func revokedJTIKey(jti string) string {
+	return "revoked_jti:" + jti
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"auth-server/internal/repository"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenVersionCacheTTL bounds how long a cached version lives in Redis; Bump
+// overwrites the cache, so this only limits memory use.
+const tokenVersionCacheTTL = 10 * time.Minute
+
+// TokenVersionStore tracks the per-user token version. Every access token
+// carries the version current at issue time and is rejected once the user's
+// version has moved past it.
+type TokenVersionStore struct {
+	userRepo repository.UserRepository
+	Redis    *redis.Client
+}
+
+func NewTokenVersionStore(userRepo repository.UserRepository, Redis *redis.Client) *TokenVersionStore {
+	return &TokenVersionStore{userRepo: userRepo, Redis: Redis}
+}
+
+// Current returns the user's token version, served from Redis when possible.
+func (s *TokenVersionStore) Current(ctx context.Context, userID uint) (int, error) {
+	version, err := s.Redis.Get(ctx, tokenVersionKey(userID)).Int()
+	if err == nil {
+		return version, nil
+	}
+	if err != redis.Nil {
+		return 0, err
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	s.Redis.Set(ctx, tokenVersionKey(userID), user.TokenVersion, tokenVersionCacheTTL)
+	return user.TokenVersion, nil
+}
+
+// Bump invalidates every token issued to the user so far.
+func (s *TokenVersionStore) Bump(ctx context.Context, userID uint) error {
+	version, err := s.userRepo.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.Redis.Set(ctx, tokenVersionKey(userID), version, tokenVersionCacheTTL).Err()
+}
+
+// Forget drops the cached version, e.g. after the user was deleted.
+func (s *TokenVersionStore) Forget(ctx context.Context, userID uint) error {
+	return s.Redis.Del(ctx, tokenVersionKey(userID)).Err()
+}
+
+func tokenVersionKey(userID uint) string {
+	return fmt.Sprintf("token_version:%d", userID)
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	pendingEnrollmentTTL = 10 * time.Minute
+	recoveryCodeCount    = 10
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrNoPendingEnrollment     = errors.New("no pending two-factor enrollment, start a new one")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorRequired       = errors.New("two-factor code required")
+)
+
+type TwoFactorService struct {
+	userRepo repository.UserRepository
+	codeRepo repository.RecoveryCodeRepository
+	limiter  *LoginLimiter
+	Redis    *redis.Client
+}
+
+func NewTwoFactorService(userRepo repository.UserRepository, codeRepo repository.RecoveryCodeRepository, limiter *LoginLimiter, Redis *redis.Client) *TwoFactorService {
+	return &TwoFactorService{userRepo: userRepo, codeRepo: codeRepo, limiter: limiter, Redis: Redis}
+}
+
+// Enroll generates a new secret and keeps it pending in Redis until the user
+// proves they can produce codes from it.
+func (s *TwoFactorService) Enroll(ctx context.Context, userID uint) (dto.TwoFactorEnrollResponse, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return dto.TwoFactorEnrollResponse{}, err
+	}
+	if user.TOTPEnabled {
+		return dto.TwoFactorEnrollResponse{}, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return dto.TwoFactorEnrollResponse{}, err
+	}
+	if err := s.Redis.Set(ctx, pendingTOTPKey(userID), secret, pendingEnrollmentTTL).Err(); err != nil {
+		return dto.TwoFactorEnrollResponse{}, err
+	}
+	return dto.TwoFactorEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: totpURI(config.AppConfig.TwoFactor.Issuer, user.UserName, secret),
+	}, nil
+}
+
+// Confirm enables 2FA once the first code checks out and returns the
+// plaintext recovery codes, which are never shown again.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID uint, code string) ([]string, error) {
+	secret, err := s.Redis.Get(ctx, pendingTOTPKey(userID)).Result()
+	if err == redis.Nil {
+		return nil, ErrNoPendingEnrollment
+	}
+	if err != nil {
+		return nil, err
+	}
+	counter, ok := validateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	plain, hashed, err := generateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.codeRepo.ReplaceCodes(ctx, userID, hashed); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateUser(ctx, userID, map[string]interface{}{
+		"totp_secret":  secret,
+		"totp_enabled": true,
+	}); err != nil {
+		return nil, err
+	}
+
+	s.Redis.Del(ctx, pendingTOTPKey(userID))
+	s.Redis.Set(ctx, usedTOTPKey(userID, counter), 1, totpReplayWindow())
+	return plain, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code.
+// Wrong codes are counted per user and lock 2FA out like wrong passwords do,
+// whichever login flow they came through.
+func (s *TwoFactorService) Verify(ctx context.Context, user *models.Users, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrTwoFactorRequired
+	}
+	if err := s.limiter.CheckTwoFactor(ctx, user); err != nil {
+		return err
+	}
+
+	err := s.verify(ctx, user, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if err := s.limiter.RecordTwoFactorFailure(ctx, user); err != nil {
+			return err
+		}
+		return ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return err
+	}
+	return s.limiter.RecordTwoFactorSuccess(ctx, user)
+}
+
+func (s *TwoFactorService) verify(ctx context.Context, user *models.Users, code string) error {
+
+	if counter, ok := validateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		// A code is only good once, even while it is still inside the window.
+		first, err := s.Redis.SetNX(ctx, usedTOTPKey(user.ID, counter), 1, totpReplayWindow()).Result()
+		if err != nil {
+			return err
+		}
+		if !first {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.codeRepo.UseCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// Reset turns 2FA off for a user; used by admins when a device is lost.
+func (s *TwoFactorService) Reset(ctx context.Context, userID uint) error {
+	if _, err := s.userRepo.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.codeRepo.DeleteCodes(ctx, userID); err != nil {
+		return err
+	}
+	s.Redis.Del(ctx, pendingTOTPKey(userID))
+	return s.userRepo.UpdateUser(ctx, userID, map[string]interface{}{
+		"totp_secret":  "",
+		"totp_enabled": false,
+	})
+}
+
+func generateRecoveryCodes(userID uint) ([]string, []*models.RecoveryCode, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	max := big.NewInt(int64(len(alphabet)))
+	plain := make([]string, 0, recoveryCodeCount)
+	hashed := make([]*models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		for j := range b {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = alphabet[n.Int64()]
+		}
+		code := string(b)
+		plain = append(plain, code[:5]+"-"+code[5:])
+		hashed = append(hashed, &models.RecoveryCode{UserID: userID, HashedCode: hashToken(code)})
+	}
+	return plain, hashed, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func totpReplayWindow() time.Duration {
+	return time.Duration(2*totpSkew+1) * totpPeriod * time.Second
+}
+
+func pendingTOTPKey(userID uint) string {
+	return fmt.Sprintf("totp_pending:%d", userID)
+}
+
+func usedTOTPKey(userID uint, counter uint64) string {
+	return fmt.Sprintf("totp_used:%d:%d", userID, counter)
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrForbidden wraps every refusal of the user policy.
+var ErrForbidden = errors.New("forbidden")
+
+// UserAction is something done to user records through /api/users.
+type UserAction string
+
+const (
+	UserList           UserAction = "list"
+	UserRead           UserAction = "read"
+	UserCreate         UserAction = "create"
+	UserUpdate         UserAction = "update"
+	UserDelete         UserAction = "delete"
+	UserResetTwoFactor UserAction = "reset 2fa of"
+	UserUnlock         UserAction = "unlock"
+	UserRevokeSessions UserAction = "revoke sessions of"
+)
+
+// userActionPermissions are the permissions that allow an action on any user.
+var userActionPermissions = map[UserAction]string{
+	UserList:           "users:read",
+	UserRead:           "users:read",
+	UserCreate:         "users:write",
+	UserUpdate:         "users:write",
+	UserDelete:         "users:delete",
+	UserResetTwoFactor: "users:write",
+	UserUnlock:         "users:write",
+	UserRevokeSessions: "sessions:revoke",
+}
+
+// privilegedUserFields can only be set by holders of the given permission,
+// even on the caller's own record: the role grants access itself, and users
+// change their own password through /api/me/password, which asks for the
+// current one.
+var privilegedUserFields = map[string]string{
+	"role":            "roles:write",
+	"hashed_password": "users:password",
+}
+
+// AuthorizeUserAction is the access policy of /api/users. Holders of the
+// action's permission, admins among them, may act on any user; everyone else
+// may only read and update their own record, and only read it with an API
+// key. Changing another user also requires holding every permission they
+// have, so that nobody can take over an account stronger than their own.
+// apiKey tells whether the caller authenticated with an API key. targetID is
+// 0 for list and create; targetPermissions are those of the target and only
+// needed for changes.
+func AuthorizeUserAction(permissions []string, callerID uint, apiKey bool, action UserAction, targetID uint, targetPermissions []string) error {
+	perm, ok := userActionPermissions[action]
+	if !ok {
+		return fmt.Errorf("%w: unknown action %s", ErrForbidden, action)
+	}
+	if !HasPermission(permissions, perm) {
+		if action != UserRead && action != UserUpdate {
+			return fmt.Errorf("%w: permission %s required", ErrForbidden, perm)
+		}
+		if targetID == 0 || targetID != callerID {
+			return fmt.Errorf("%w: permission %s required to %s other users", ErrForbidden, perm, action)
+		}
+		if apiKey && ChangesUser(action) {
+			return fmt.Errorf("%w: cannot %s your own user with an api key", ErrForbidden, action)
+		}
+		return nil
+	}
+	if ChangesUser(action) && targetID != callerID && !HasAllPermissions(permissions, targetPermissions) {
+		return fmt.Errorf("%w: cannot %s a user with permissions you do not have", ErrForbidden, action)
+	}
+	return nil
+}
+
+// ChangesUser reports whether action changes an existing user, which makes
+// AuthorizeUserAction compare the caller's permissions with the target's.
+func ChangesUser(action UserAction) bool {
+	return action != UserList && action != UserRead && action != UserCreate
+}
+
+// otherUserFields also need the given permission when set on an existing user
+// other than the caller: whoever controls the email can reset the password.
+var otherUserFields = map[string]string{
+	"email": "users:password",
+}
+
+// AuthorizeUserFields checks that the caller may set every one of fields,
+// on top of AuthorizeUserAction. otherUser tells whether the fields are set
+// on an existing user other than the caller.
+func AuthorizeUserFields(permissions []string, otherUser bool, fields []string) error {
+	for _, field := range fields {
+		perm, ok := privilegedUserFields[field]
+		if !ok && otherUser {
+			perm, ok = otherUserFields[field]
+		}
+		if ok && !HasPermission(permissions, perm) {
+			return fmt.Errorf("%w: permission %s required to set %s", ErrForbidden, perm, field)
+		}
+	}
+	return nil
+}
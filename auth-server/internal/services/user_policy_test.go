@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+var (
+	adminPermissions   = []string{"*"}
+	supportPermissions = []string{"users:read", "users:write", "sessions:revoke"}
+	userPermissions    = []string{}
+)
+
+const (
+	callerID    uint = 1
+	otherUserID uint = 2
+	adminID     uint = 3
+)
+
+func TestAuthorizeUserAction(t *testing.T) {
+	type target struct {
+		id          uint
+		permissions []string
+	}
+	var (
+		none  = target{}
+		self  = target{callerID, nil}
+		other = target{otherUserID, userPermissions}
+		admin = target{adminID, adminPermissions}
+	)
+
+	tests := []struct {
+		caller  string
+		perms   []string
+		action  UserAction
+		target  target
+		allowed bool
+	}{
+		{"admin", adminPermissions, UserList, none, true},
+		{"admin", adminPermissions, UserCreate, none, true},
+		{"admin", adminPermissions, UserRead, self, true},
+		{"admin", adminPermissions, UserRead, other, true},
+		{"admin", adminPermissions, UserRead, admin, true},
+		{"admin", adminPermissions, UserUpdate, self, true},
+		{"admin", adminPermissions, UserUpdate, other, true},
+		{"admin", adminPermissions, UserUpdate, admin, true},
+		{"admin", adminPermissions, UserDelete, self, true},
+		{"admin", adminPermissions, UserDelete, other, true},
+		{"admin", adminPermissions, UserDelete, admin, true},
+		{"admin", adminPermissions, UserResetTwoFactor, admin, true},
+
+		{"support", supportPermissions, UserList, none, true},
+		{"support", supportPermissions, UserCreate, none, true},
+		{"support", supportPermissions, UserRead, self, true},
+		{"support", supportPermissions, UserRead, other, true},
+		{"support", supportPermissions, UserRead, admin, true},
+		{"support", supportPermissions, UserUpdate, self, true},
+		{"support", supportPermissions, UserUpdate, other, true},
+		{"support", supportPermissions, UserUpdate, admin, false},
+		{"support", supportPermissions, UserDelete, self, false},
+		{"support", supportPermissions, UserDelete, other, false},
+		{"support", supportPermissions, UserDelete, admin, false},
+		{"support", supportPermissions, UserResetTwoFactor, other, true},
+		{"support", supportPermissions, UserResetTwoFactor, admin, false},
+		{"support", supportPermissions, UserUnlock, admin, false},
+		{"support", supportPermissions, UserRevokeSessions, other, true},
+		{"support", supportPermissions, UserRevokeSessions, admin, false},
+		{"support", supportPermissions, UserUpdate, target{otherUserID, []string{"users:read"}}, true},
+		{"support", supportPermissions, UserUpdate, target{otherUserID, []string{"billing:write"}}, false},
+
+		{"user", userPermissions, UserList, none, false},
+		{"user", userPermissions, UserCreate, none, false},
+		{"user", userPermissions, UserRead, self, true},
+		{"user", userPermissions, UserRead, other, false},
+		{"user", userPermissions, UserRead, admin, false},
+		{"user", userPermissions, UserUpdate, self, true},
+		{"user", userPermissions, UserUpdate, other, false},
+		{"user", userPermissions, UserUpdate, admin, false},
+		{"user", userPermissions, UserDelete, self, false},
+		{"user", userPermissions, UserDelete, other, false},
+		{"user", userPermissions, UserDelete, admin, false},
+		{"user", userPermissions, UserResetTwoFactor, self, false},
+
+		{"unknown action", adminPermissions, UserAction("promote"), other, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.caller+" "+string(tt.action)+" "+targetName(tt.target.id), func(t *testing.T) {
+			err := AuthorizeUserAction(tt.perms, callerID, false, tt.action, tt.target.id, tt.target.permissions)
+			if tt.allowed && err != nil {
+				t.Fatalf("refused: %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbidden) {
+				t.Fatalf("err = %v, want %v", err, ErrForbidden)
+			}
+		})
+	}
+}
+
+func TestAuthorizeUserActionWithAPIKey(t *testing.T) {
+	tests := []struct {
+		caller  string
+		perms   []string
+		action  UserAction
+		target  uint
+		allowed bool
+	}{
+		{"key without scopes", userPermissions, UserRead, callerID, true},
+		{"key without scopes", userPermissions, UserUpdate, callerID, false},
+		{"key without scopes", userPermissions, UserUpdate, otherUserID, false},
+		{"key with users:write", []string{"users:write"}, UserUpdate, otherUserID, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.caller+" "+string(tt.action)+" "+targetName(tt.target), func(t *testing.T) {
+			err := AuthorizeUserAction(tt.perms, callerID, true, tt.action, tt.target, userPermissions)
+			if tt.allowed && err != nil {
+				t.Fatalf("refused: %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbidden) {
+				t.Fatalf("err = %v, want %v", err, ErrForbidden)
+			}
+		})
+	}
+}
+
+func TestAuthorizeUserFields(t *testing.T) {
+	tests := []struct {
+		caller  string
+		perms   []string
+		other   bool
+		fields  []string
+		allowed bool
+	}{
+		{"admin", adminPermissions, true, []string{"role"}, true},
+		{"admin", adminPermissions, true, []string{"hashed_password"}, true},
+		{"admin", adminPermissions, true, []string{"email", "role", "hashed_password"}, true},
+		{"support", supportPermissions, false, []string{"email"}, true},
+		{"support", supportPermissions, true, []string{"email"}, false},
+		{"support", supportPermissions, true, []string{"role"}, false},
+		{"support", supportPermissions, true, []string{"hashed_password"}, false},
+		{"support", supportPermissions, true, []string{"email", "hashed_password"}, false},
+		{"password manager", []string{"users:write", "users:password"}, true, []string{"hashed_password"}, true},
+		{"password manager", []string{"users:write", "users:password"}, true, []string{"email"}, true},
+		{"role manager", []string{"users:write", "roles:write"}, true, []string{"role"}, true},
+		{"role manager", []string{"users:write", "roles:write"}, true, []string{"email"}, false},
+		{"user", userPermissions, false, nil, true},
+		{"user", userPermissions, false, []string{"email"}, true},
+		{"user", userPermissions, false, []string{"role"}, false},
+		{"user", userPermissions, false, []string{"hashed_password"}, false},
+	}
+	for _, tt := range tests {
+		name := tt.caller + " self"
+		if tt.other {
+			name = tt.caller + " other"
+		}
+		t.Run(name, func(t *testing.T) {
+			err := AuthorizeUserFields(tt.perms, tt.other, tt.fields)
+			if tt.allowed && err != nil {
+				t.Fatalf("%v refused: %v", tt.fields, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbidden) {
+				t.Fatalf("%v: err = %v, want %v", tt.fields, err, ErrForbidden)
+			}
+		})
+	}
+}
+
+func targetName(id uint) string {
+	switch id {
+	case 0:
+		return "none"
+	case callerID:
+		return "self"
+	case adminID:
+		return "admin"
+	}
+	return "other"
+}
@@ -1,17 +1,40 @@
 package services
 
 import (
+	"auth-server/internal/dto"
 	"auth-server/internal/models"
 	"auth-server/internal/repository"
 	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// recentLoginMaxAge is how recently the session changing the user's password
+// or email must have been logged in.
+const recentLoginMaxAge = 5 * time.Minute
+
+var (
+	ErrWrongPassword  = errors.New("current password is incorrect")
+	ErrReauthRequired = errors.New("log in again to make this change")
+	ErrUserNameTaken  = repository.ErrUserNameTaken
+	ErrEmailTaken     = repository.ErrEmailTaken
 )
 
 type UserService struct {
-	Repo repository.UserRepository
+	Repo     repository.UserRepository
+	limiter  *LoginLimiter
+	sessions *SessionService
+	versions *TokenVersionStore
+	roles    *RoleService
+	policy   *PasswordPolicy
+	apiKeys  repository.APIKeyRepository
 }
 
-func NewUserService(repo repository.UserRepository) *UserService {
-	return &UserService{Repo: repo}
+func NewUserService(repo repository.UserRepository, limiter *LoginLimiter, sessions *SessionService, versions *TokenVersionStore, roles *RoleService, policy *PasswordPolicy, apiKeys repository.APIKeyRepository) *UserService {
+	return &UserService{Repo: repo, limiter: limiter, sessions: sessions, versions: versions, roles: roles, policy: policy, apiKeys: apiKeys}
 }
 func (s *UserService) GetAllUsers(ctx context.Context) ([]*models.Users, error) {
 	return s.Repo.GetAllUsers(ctx)
@@ -19,14 +42,174 @@ func (s *UserService) GetAllUsers(ctx context.Context) ([]*models.Users, error)
 func (s *UserService) GetUserByID(ctx context.Context, id uint) (*models.Users, error) {
 	return s.Repo.GetUserByID(ctx, id)
 }
-func (s *UserService) CreateUser(ctx context.Context, user *models.Users) error {
-	return s.Repo.CreateUser(ctx, user)
+
+// CreateUser checks password against the password policy, then creates the
+// user with it. User names are unique ignoring case.
+func (s *UserService) CreateUser(ctx context.Context, user *models.Users, password string) error {
+	if err := s.checkRole(ctx, user.Role); err != nil {
+		return err
+	}
+	// Also enforced by the database; checked here too so the error is clear
+	// where the unique index could not be created yet.
+	if _, err := s.Repo.GetUserByUserName(ctx, user.UserName); err == nil {
+		return ErrUserNameTaken
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err := s.policy.Validate(ctx, user, password); err != nil {
+		return err
+	}
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.HashedPassword = hashed
+	if err := s.Repo.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	return s.policy.Record(ctx, user.ID, hashed)
+}
+
+// ValidatePassword checks password against the policy without setting it.
+func (s *UserService) ValidatePassword(ctx context.Context, user *models.Users, password string) error {
+	return s.policy.Validate(ctx, user, password)
+}
+
+func (s *UserService) setPassword(ctx context.Context, id uint, password string) error {
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.UpdateUser(ctx, id, map[string]interface{}{"hashed_password": hashed})
 }
+
+// UpdateUser applies the updates and invalidates the user's existing tokens
+// when the role or password changed. A password change is also added to the
+// password history, and ends every session and deletes the user's API keys so
+// that credentials obtained with the old password stop working. Passwords
+// must already have passed ValidatePassword.
 func (s *UserService) UpdateUser(ctx context.Context, id uint, updates map[string]interface{}) error {
-	return s.Repo.UpdateUser(ctx, id, updates)
+	if role, ok := updates["role"].(string); ok {
+		if err := s.checkRole(ctx, role); err != nil {
+			return err
+		}
+	}
+	if err := s.Repo.UpdateUser(ctx, id, updates); err != nil {
+		return err
+	}
+	_, roleChanged := updates["role"]
+	hashed, passwordChanged := updates["hashed_password"].(string)
+	if !roleChanged && !passwordChanged {
+		return nil
+	}
+	if err := s.versions.Bump(ctx, id); err != nil {
+		return err
+	}
+	if !passwordChanged {
+		return nil
+	}
+	if err := s.policy.Record(ctx, id, hashed); err != nil {
+		return err
+	}
+	return s.revokeCredentials(ctx, id, "")
+}
+
+// RequireRecentLogin returns ErrReauthRequired unless the session sessionID
+// belongs to userID and was logged in within recentLoginMaxAge. Changes that
+// would let someone take over the account, like its password or email, ask
+// for it so that a stolen token alone is not enough.
+func (s *UserService) RequireRecentLogin(ctx context.Context, userID uint, sessionID string) error {
+	_, err := s.recentSession(ctx, userID, sessionID)
+	return err
+}
+
+func (s *UserService) recentSession(ctx context.Context, userID uint, sessionID string) (*Session, error) {
+	if sessionID == "" {
+		return nil, ErrReauthRequired
+	}
+	sess, err := s.sessions.Get(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrReauthRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sess.UserID != userID || time.Since(sess.CreatedAt) > recentLoginMaxAge {
+		return nil, ErrReauthRequired
+	}
+	return sess, nil
 }
+
+// ChangeEmail lets a user set their email from the session sessionID, which
+// must pass RequireRecentLogin.
+func (s *UserService) ChangeEmail(ctx context.Context, userID uint, sessionID, email string) error {
+	if err := s.RequireRecentLogin(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	return s.UpdateUser(ctx, userID, map[string]interface{}{"email": email})
+}
+
+// ChangePassword lets a user set a new password from the session sessionID,
+// which must pass RequireRecentLogin. Wrong current passwords count as failed
+// logins. Every other session of the user is ended and their API keys are
+// deleted; the calling session stays logged in.
+func (s *UserService) ChangePassword(ctx context.Context, userID uint, sessionID, current, password string, client dto.ClientInfo) error {
+	sess, err := s.recentSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.Repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.limiter.Check(ctx, user.UserName, client.IP); err != nil {
+		return err
+	}
+	if err := s.limiter.CheckUser(user); err != nil {
+		return err
+	}
+	if !CheckPassword(user.HashedPassword, current) {
+		if err := s.limiter.RecordFailure(ctx, user, user.UserName, client.IP); err != nil {
+			return err
+		}
+		return ErrWrongPassword
+	}
+	if err := s.policy.Validate(ctx, user, password); err != nil {
+		return err
+	}
+
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.UpdateUser(ctx, userID, map[string]interface{}{"hashed_password": hashed}); err != nil {
+		return err
+	}
+	if err := s.policy.Record(ctx, userID, hashed); err != nil {
+		return err
+	}
+	return s.revokeCredentials(ctx, userID, sess.ID)
+}
+
+// revokeCredentials ends the user's sessions but keepSessionID and deletes
+// their API keys after a password change. Keys are deleted rather than kept
+// because whoever knew the old password could have created them.
+func (s *UserService) revokeCredentials(ctx context.Context, userID uint, keepSessionID string) error {
+	if err := s.sessions.RevokeAllForUser(ctx, userID, keepSessionID); err != nil {
+		return err
+	}
+	return s.apiKeys.DeleteKeysByUserID(ctx, userID)
+}
+
 func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
-	return s.Repo.DeleteUser(ctx, id)
+	if err := s.Repo.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	if err := s.versions.Forget(ctx, id); err != nil {
+		return err
+	}
+	return s.sessions.RevokeAllForUser(ctx, id, "")
 }
 func (s *UserService) CheckRole(ctx context.Context, id uint) (string, error) {
 	role, err := s.Repo.CheckRole(ctx, id)
@@ -35,3 +218,22 @@ func (s *UserService) CheckRole(ctx context.Context, id uint) (string, error) {
 	}
 	return role, nil
 }
+func (s *UserService) UnlockUser(ctx context.Context, id uint) error {
+	user, err := s.Repo.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.limiter.Unlock(ctx, user)
+}
+
+// checkRole makes sure a user's primary role is one defined in the roles table.
+func (s *UserService) checkRole(ctx context.Context, role string) error {
+	ok, err := s.roles.RoleExists(ctx, role)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+	return nil
+}
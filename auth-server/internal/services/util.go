@@ -2,10 +2,64 @@
 package services
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync"
 )
 
+// HashPassword hashes with the algorithm set in config.yaml.
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hash), err
+	return passwordHasher().Hash(password)
+}
+
+// CheckPassword reports whether password matches a hash from HashPassword,
+// whichever algorithm made it.
+func CheckPassword(hash, password string) bool {
+	ok, err := hasherFor(hash).Verify(hash, password)
+	return err == nil && ok
+}
+
+// PasswordNeedsRehash reports whether hash was made with another algorithm or
+// weaker parameters than the configured ones.
+func PasswordNeedsRehash(hash string) bool {
+	return passwordHasher().NeedsRehash(hash)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkDummyPassword spends as long as CheckPassword does, so a login for an
+// unknown user takes the same time as a wrong password for a real one.
+func checkDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy password for timing")
+	})
+	CheckPassword(dummyHash, password)
+}
+
+// generateRandomToken returns n random bytes encoded as URL-safe base64.
+func generateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is used for opaque tokens that are stored server side; they carry
+// enough entropy that a plain SHA-256 is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeEmail trims and lower-cases an address so lookups match however
+// the user typed it.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
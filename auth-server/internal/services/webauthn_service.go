@@ -0,0 +1,321 @@
+package services
+
+import (
+	"auth-server/internal/config"
+	"auth-server/internal/dto"
+	"auth-server/internal/models"
+	"auth-server/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const webAuthnCeremonyTTL = 5 * time.Minute
+
+var (
+	ErrInvalidCeremony = errors.New("invalid or expired passkey ceremony")
+	ErrInvalidPasskey  = errors.New("passkey verification failed")
+	ErrPasskeyNotFound = errors.New("passkey not found")
+	ErrPasskeyRequired = errors.New("your role requires signing in with a passkey")
+	ErrLastPasskey     = errors.New("your role requires a passkey; register another one before deleting this one")
+)
+
+// webAuthnUser adapts a user and their passkeys to webauthn.User. The user
+// handle is the decimal user ID.
+type webAuthnUser struct {
+	user        *models.Users
+	credentials []*models.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatUint(uint64(u.user.ID), 10))
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.UserName
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.UserName
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		transports := []protocol.AuthenticatorTransport{}
+		for _, t := range c.TransportList() {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(c.Flags)),
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       c.AAGUID,
+				SignCount:    c.SignCount,
+				CloneWarning: c.CloneWarning,
+			},
+		})
+	}
+	return credentials
+}
+
+// WebAuthnService registers passkeys and signs users in with them. Ceremony
+// state lives in Redis between the begin and finish calls:
+// webauthn_registration:<user id> and webauthn_login:<sha256(challenge id)>.
+type WebAuthnService struct {
+	repo     repository.WebAuthnCredentialRepository
+	userRepo repository.UserRepository
+	auth     *AuthService
+	Redis    *redis.Client
+}
+
+func NewWebAuthnService(repo repository.WebAuthnCredentialRepository, userRepo repository.UserRepository, auth *AuthService, Redis *redis.Client) *WebAuthnService {
+	return &WebAuthnService{repo: repo, userRepo: userRepo, auth: auth, Redis: Redis}
+}
+
+// BeginRegistration returns the options for navigator.credentials.create.
+// Passkeys are created as discoverable credentials so login needs no user
+// name.
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID uint) (*protocol.CredentialCreation, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing := webauthn.Credentials(user.WebAuthnCredentials())
+	options, session, err := rp.BeginRegistration(user,
+		webauthn.WithExclusions(existing.CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveCeremony(ctx, registrationKey(userID), session); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// FinishRegistration verifies the authenticator's response and stores the
+// new passkey.
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID uint, name string, body []byte) (*models.WebAuthnCredential, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.takeCeremony(ctx, registrationKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := rp.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	if strings.TrimSpace(name) == "" {
+		name = "Passkey"
+	}
+	transports := []string{}
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	record := &models.WebAuthnCredential{
+		UserID:          userID,
+		Name:            strings.TrimSpace(name),
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, " "),
+		AAGUID:          credential.Authenticator.AAGUID,
+		Flags:           uint8(credential.Flags.ProtocolValue()),
+		SignCount:       credential.Authenticator.SignCount,
+	}
+	if err := s.repo.CreateCredential(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *WebAuthnService) List(ctx context.Context, userID uint) ([]*models.WebAuthnCredential, error) {
+	return s.repo.GetCredentialsByUserID(ctx, userID)
+}
+
+// Delete removes one of the user's passkeys. Users whose role requires
+// passkey sign-in cannot delete their last one, which would lock them out.
+func (s *WebAuthnService) Delete(ctx context.Context, userID, id uint) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	required, err := s.auth.roles.RequiresPasskey(ctx, user)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteCredential(ctx, userID, id, required)
+	if errors.Is(err, repository.ErrLastCredential) {
+		return ErrLastPasskey
+	}
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// BeginLogin starts a discoverable login and returns the options for
+// navigator.credentials.get with the ID to pass back to FinishLogin.
+func (s *WebAuthnService) BeginLogin(ctx context.Context) (string, *protocol.CredentialAssertion, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return "", nil, err
+	}
+	options, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return "", nil, err
+	}
+	challengeID, err := generateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.saveCeremony(ctx, loginCeremonyKey(challengeID), session); err != nil {
+		return "", nil, err
+	}
+	return challengeID, options, nil
+}
+
+// FinishLogin verifies the assertion and starts a session, as Login does
+// after a password check. An assertion whose signature counter went
+// backwards suggests a cloned authenticator and is refused.
+func (s *WebAuthnService) FinishLogin(ctx context.Context, challengeID string, body []byte, client dto.ClientInfo) (dto.LoginResponse, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	session, err := s.takeCeremony(ctx, loginCeremonyKey(challengeID))
+	if err != nil {
+		return dto.LoginResponse{}, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body)
+	if err != nil {
+		return dto.LoginResponse{}, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	var owner *webAuthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		id, err := strconv.ParseUint(string(userHandle), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		owner, err = s.loadUser(ctx, uint(id))
+		return owner, err
+	}
+	_, credential, err := rp.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		return dto.LoginResponse{}, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+
+	record := owner.credential(credential.ID)
+	if record == nil {
+		return dto.LoginResponse{}, ErrInvalidPasskey
+	}
+	now := time.Now()
+	record.SignCount = credential.Authenticator.SignCount
+	record.Flags = uint8(credential.Flags.ProtocolValue())
+	record.CloneWarning = credential.Authenticator.CloneWarning
+	record.LastUsedAt = &now
+	if err := s.repo.UpdateCredentialUse(ctx, record); err != nil {
+		return dto.LoginResponse{}, err
+	}
+	if record.CloneWarning {
+		log.Printf("passkey %d of user %d may be cloned, refusing login", record.ID, owner.user.ID)
+		return dto.LoginResponse{}, fmt.Errorf("%w: signature counter went backwards", ErrInvalidPasskey)
+	}
+	return s.auth.startSession(ctx, owner.user, client)
+}
+
+func (s *WebAuthnService) loadUser(ctx context.Context, userID uint) (*webAuthnUser, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.repo.GetCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+func (u *webAuthnUser) credential(id []byte) *models.WebAuthnCredential {
+	for _, c := range u.credentials {
+		if string(c.CredentialID) == string(id) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *WebAuthnService) saveCeremony(ctx context.Context, key string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.Redis.Set(ctx, key, data, webAuthnCeremonyTTL).Err()
+}
+
+// takeCeremony loads and deletes ceremony state, so each can finish once.
+func (s *WebAuthnService) takeCeremony(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	raw, err := s.Redis.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidCeremony
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(raw), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func relyingParty() (*webauthn.WebAuthn, error) {
+	cfg := config.AppConfig.WebAuthn
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+	})
+}
+
+func registrationKey(userID uint) string {
+	return fmt.Sprintf("webauthn_registration:%d", userID)
+}
+
+func loginCeremonyKey(challengeID string) string {
+	return "webauthn_login:" + hashToken(challengeID)
+}